@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// charmap maps the bytes 0x80-0xFF of a single-byte encoding to runes; bytes
+// below 0x80 are ASCII in every encoding gator supports.
+type charmap *[128]rune
+
+// charmaps holds the supported encodings by normalized label. ISO-8859-1 and
+// US-ASCII map every byte to the code point of the same value, so they have
+// no table.
+var charmaps = map[string]charmap{
+	"iso-8859-1":   nil,
+	"iso-8859-15":  &latin9,
+	"windows-1252": &windows1252,
+	"windows-1251": &windows1251,
+	"koi8-r":       &koi8r,
+}
+
+// charsetAliases maps other common labels to the names used in charmaps.
+var charsetAliases = map[string]string{
+	"latin1":      "iso-8859-1",
+	"l1":          "iso-8859-1",
+	"iso8859-1":   "iso-8859-1",
+	"iso_8859-1":  "iso-8859-1",
+	"us-ascii":    "iso-8859-1",
+	"ascii":       "iso-8859-1",
+	"latin-9":     "iso-8859-15",
+	"latin9":      "iso-8859-15",
+	"iso8859-15":  "iso-8859-15",
+	"iso_8859-15": "iso-8859-15",
+	"cp1252":      "windows-1252",
+	"x-cp1252":    "windows-1252",
+	"cp1251":      "windows-1251",
+	"x-cp1251":    "windows-1251",
+	"koi8r":       "koi8-r",
+	"utf8":        "utf-8",
+}
+
+// normalizeCharset lowercases label and resolves aliases.
+func normalizeCharset(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if alias, ok := charsetAliases[label]; ok {
+		return alias
+	}
+	return label
+}
+
+func isKnownCharset(label string) bool {
+	if label == "utf-8" {
+		return true
+	}
+	_, ok := charmaps[label]
+	return ok
+}
+
+// charsetReader is the xml.Decoder CharsetReader gator uses. It transcodes
+// the encodings in charmaps to UTF-8.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	label = normalizeCharset(label)
+	if label == "utf-8" {
+		return input, nil
+	}
+	table, ok := charmaps[label]
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(decodeCharmap(table, data)), nil
+}
+
+func decodeCharmap(table charmap, data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/2)
+	for _, b := range data {
+		switch {
+		case b < 0x80:
+			out = append(out, b)
+		case table == nil:
+			out = utf8.AppendRune(out, rune(b))
+		default:
+			out = utf8.AppendRune(out, table[b-0x80])
+		}
+	}
+	return out
+}
+
+var (
+	xmlDeclaration = regexp.MustCompile(`^\s*<\?xml[^>]*\?>`)
+	xmlEncoding    = regexp.MustCompile(`(encoding\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+)
+
+// declaredEncoding returns the encoding named in the XML declaration, if any.
+func declaredEncoding(data []byte) string {
+	decl := xmlDeclaration.Find(data)
+	if decl == nil {
+		return ""
+	}
+	m := xmlEncoding.FindSubmatch(decl)
+	if m == nil {
+		return ""
+	}
+	return string(m[2]) + string(m[3])
+}
+
+// setDeclaredEncoding rewrites the encoding in the XML declaration, so
+// xml.Decoder does not transcode a document that already was.
+func setDeclaredEncoding(data []byte, encoding string) []byte {
+	decl := xmlDeclaration.Find(data)
+	if decl == nil || !xmlEncoding.Match(decl) {
+		return data
+	}
+	newDecl := xmlEncoding.ReplaceAll(decl, []byte(`${1}"`+encoding+`"`))
+	return append(newDecl, data[len(decl):]...)
+}
+
+// prepareXML settles the encoding of an XML document before it is decoded.
+// A UTF-8 byte order mark wins, then the charset of the HTTP Content-Type,
+// then the XML declaration, which is left to charsetReader. Documents that
+// declare nothing, or are not the UTF-8 they claim to be, are transcoded
+// from the encoding detectCharset guesses. A declared encoding gator has no
+// table for is an error rather than a guess, which would garble the text.
+func prepareXML(contentType string, data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte("\ufeff")) {
+		return setDeclaredEncoding(data[3:], "UTF-8"), nil
+	}
+
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = normalizeCharset(params["charset"])
+	}
+	declared := normalizeCharset(declaredEncoding(data))
+	if !isKnownCharset(label) && (label == "" || isKnownCharset(declared)) {
+		label = declared
+		if label != "" && label != "utf-8" && isKnownCharset(label) {
+			// charsetReader transcodes it while decoding.
+			return data, nil
+		}
+	}
+	if label != "" && !isKnownCharset(label) {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+
+	if label == "" || label == "utf-8" {
+		if utf8.Valid(data) {
+			return setDeclaredEncoding(data, "UTF-8"), nil
+		}
+		label = detectCharset(data)
+	}
+	return setDeclaredEncoding(decodeCharmap(charmaps[label], data), "UTF-8"), nil
+}
+
+// detectCharset guesses the single-byte encoding of data that is not valid
+// UTF-8. Cyrillic text is written almost entirely in bytes from 0xC0 up, so
+// they come in runs, while accented Latin letters mostly stand alone between
+// ASCII ones. windows-1251 puts lowercase letters at 0xE0-0xFF and KOI8-R
+// puts them at 0xC0-0xDF, and lowercase dominates running text. Anything
+// else is read as windows-1252, the superset of ISO-8859-1 browsers use.
+func detectCharset(data []byte) string {
+	var upper, lower, runs int
+	prevHigh := false
+	for _, b := range data {
+		high := b >= 0xC0
+		switch {
+		case b >= 0xE0:
+			lower++
+		case high:
+			upper++
+		}
+		if high && prevHigh {
+			runs++
+		}
+		prevHigh = high
+	}
+	if total := upper + lower; total == 0 || runs*2 < total {
+		return "windows-1252"
+	}
+	if lower >= upper {
+		return "windows-1251"
+	}
+	return "koi8-r"
+}
+
+// latin9 is ISO-8859-15: ISO-8859-1 with the euro sign and a few letters
+// for French and Finnish in place of rarely used symbols.
+var latin9 = [128]rune{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x008D, 0x008E, 0x008F,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009A, 0x009B, 0x009C, 0x009D, 0x009E, 0x009F,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x20AC, 0x00A5, 0x0160, 0x00A7,
+	0x0161, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x017D, 0x00B5, 0x00B6, 0x00B7,
+	0x017E, 0x00B9, 0x00BA, 0x00BB, 0x0152, 0x0153, 0x0178, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
+
+// windows1252 is the Windows Western European code page. Bytes it leaves
+// undefined map to the C1 control of the same value, as in browsers.
+var windows1252 = [128]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x00B9, 0x00BA, 0x00BB, 0x00BC, 0x00BD, 0x00BE, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
+
+// windows1251 is the Windows Cyrillic code page.
+var windows1251 = [128]rune{
+	0x0402, 0x0403, 0x201A, 0x0453, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x20AC, 0x2030, 0x0409, 0x2039, 0x040A, 0x040C, 0x040B, 0x040F,
+	0x0452, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x0098, 0x2122, 0x0459, 0x203A, 0x045A, 0x045C, 0x045B, 0x045F,
+	0x00A0, 0x040E, 0x045E, 0x0408, 0x00A4, 0x0490, 0x00A6, 0x00A7,
+	0x0401, 0x00A9, 0x0404, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x0407,
+	0x00B0, 0x00B1, 0x0406, 0x0456, 0x0491, 0x00B5, 0x00B6, 0x00B7,
+	0x0451, 0x2116, 0x0454, 0x00BB, 0x0458, 0x0405, 0x0455, 0x0457,
+	0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+	0x0418, 0x0419, 0x041A, 0x041B, 0x041C, 0x041D, 0x041E, 0x041F,
+	0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+	0x0428, 0x0429, 0x042A, 0x042B, 0x042C, 0x042D, 0x042E, 0x042F,
+	0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+	0x0438, 0x0439, 0x043A, 0x043B, 0x043C, 0x043D, 0x043E, 0x043F,
+	0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+	0x0448, 0x0449, 0x044A, 0x044B, 0x044C, 0x044D, 0x044E, 0x044F,
+}
+
+// koi8r is KOI8-R, the Russian Unix encoding.
+var koi8r = [128]rune{
+	0x2500, 0x2502, 0x250C, 0x2510, 0x2514, 0x2518, 0x251C, 0x2524,
+	0x252C, 0x2534, 0x253C, 0x2580, 0x2584, 0x2588, 0x258C, 0x2590,
+	0x2591, 0x2592, 0x2593, 0x2320, 0x25A0, 0x2219, 0x221A, 0x2248,
+	0x2264, 0x2265, 0x00A0, 0x2321, 0x00B0, 0x00B2, 0x00B7, 0x00F7,
+	0x2550, 0x2551, 0x2552, 0x0451, 0x2553, 0x2554, 0x2555, 0x2556,
+	0x2557, 0x2558, 0x2559, 0x255A, 0x255B, 0x255C, 0x255D, 0x255E,
+	0x255F, 0x2560, 0x2561, 0x0401, 0x2562, 0x2563, 0x2564, 0x2565,
+	0x2566, 0x2567, 0x2568, 0x2569, 0x256A, 0x256B, 0x256C, 0x00A9,
+	0x044E, 0x0430, 0x0431, 0x0446, 0x0434, 0x0435, 0x0444, 0x0433,
+	0x0445, 0x0438, 0x0439, 0x043A, 0x043B, 0x043C, 0x043D, 0x043E,
+	0x043F, 0x044F, 0x0440, 0x0441, 0x0442, 0x0443, 0x0436, 0x0432,
+	0x044C, 0x044B, 0x0437, 0x0448, 0x044D, 0x0449, 0x0447, 0x044A,
+	0x042E, 0x0410, 0x0411, 0x0426, 0x0414, 0x0415, 0x0424, 0x0413,
+	0x0425, 0x0418, 0x0419, 0x041A, 0x041B, 0x041C, 0x041D, 0x041E,
+	0x041F, 0x042F, 0x0420, 0x0421, 0x0422, 0x0423, 0x0416, 0x0412,
+	0x042C, 0x042B, 0x0417, 0x0428, 0x042D, 0x0429, 0x0427, 0x042A,
+}
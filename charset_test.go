@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// encodeCharmap is the inverse of decodeCharmap, for building test feeds.
+func encodeCharmap(t *testing.T, label, s string) []byte {
+	t.Helper()
+	table := charmaps[label]
+	var out []byte
+	for _, r := range s {
+		if r < 0x80 {
+			out = append(out, byte(r))
+			continue
+		}
+		found := false
+		for i := range 128 {
+			if (table == nil && rune(i+0x80) == r) || (table != nil && table[i] == r) {
+				out = append(out, byte(i+0x80))
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("%q cannot be encoded in %s", r, label)
+		}
+	}
+	return out
+}
+
+func TestParseFeedCharsets(t *testing.T) {
+	tests := []struct {
+		label string
+		title string
+	}{
+		{"iso-8859-1", "Les élèves à l'école: ça marche, Müller und Søn"},
+		{"iso-8859-15", "Prix: 20 € pour l'œuvre de Šimon"},
+		{"windows-1252", "“Smart quotes” — and a café … naïve"},
+		{"windows-1251", "Новости науки: свежие публикации"},
+		{"koi8-r", "Последние новости и статьи"},
+	}
+
+	for _, tt := range tests {
+		doc := fmt.Sprintf(`<rss version="2.0"><channel><title>%s</title><item><title>%s</title></item></channel></rss>`, tt.title, tt.title)
+
+		t.Run(tt.label+" declaration", func(t *testing.T) {
+			data := encodeCharmap(t, tt.label, fmt.Sprintf(`<?xml version="1.0" encoding="%s"?>`, tt.label)+doc)
+			checkCharsetTitle(t, "application/rss+xml", data, tt.title)
+		})
+
+		t.Run(tt.label+" HTTP charset", func(t *testing.T) {
+			// The HTTP header wins over a wrong declaration.
+			data := encodeCharmap(t, tt.label, `<?xml version="1.0" encoding="UTF-8"?>`+doc)
+			checkCharsetTitle(t, "text/xml; charset="+tt.label, data, tt.title)
+		})
+	}
+
+	detected := []struct {
+		label string
+		title string
+	}{
+		{"windows-1252", "Les élèves à l'école"},
+		{"windows-1251", "Новости науки: свежие публикации"},
+		{"koi8-r", "Последние новости и статьи"},
+	}
+	for _, tt := range detected {
+		t.Run(tt.label+" detected", func(t *testing.T) {
+			doc := fmt.Sprintf(`<rss version="2.0"><channel><title>%s</title></channel></rss>`, tt.title)
+			data := encodeCharmap(t, tt.label, doc)
+			if got := detectCharset(data); got != tt.label {
+				t.Errorf("expected %s to be detected but got %s", tt.label, got)
+			}
+			checkCharsetTitle(t, "application/rss+xml", data, tt.title)
+		})
+	}
+}
+
+func TestParseFeedUnsupportedCharset(t *testing.T) {
+	// "Škoda žije" in ISO-8859-2, which windows-1252 would read as "©koda ¾ije".
+	doc := "<rss version=\"2.0\"><channel><title>\xa9koda \xbeije</title></channel></rss>"
+	tests := []struct {
+		name        string
+		contentType string
+		data        string
+		want        string
+	}{
+		{"declaration", "application/rss+xml", `<?xml version="1.0" encoding="ISO-8859-2"?>` + doc, "iso-8859-2"},
+		{"HTTP charset", "text/xml; charset=windows-1250", doc, "windows-1250"},
+		{"both unknown", "text/xml; charset=windows-1250", `<?xml version="1.0" encoding="ISO-8859-2"?>` + doc, "windows-1250"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFeed(tt.contentType, []byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("unsupported charset %q", tt.want)) {
+				t.Errorf("expected an unsupported charset error for %s but got: %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("HTTP charset unknown, declaration known", func(t *testing.T) {
+		title := "Les élèves à l'école"
+		data := encodeCharmap(t, "iso-8859-1", `<?xml version="1.0" encoding="ISO-8859-1"?>`+
+			`<rss version="2.0"><channel><title>`+title+`</title></channel></rss>`)
+		checkCharsetTitle(t, "text/xml; charset=x-unknown", data, title)
+	})
+}
+
+func checkCharsetTitle(t *testing.T, contentType string, data []byte, want string) {
+	t.Helper()
+	feed, err := parseFeed(contentType, data)
+	if err != nil {
+		t.Fatalf("failed to parse feed: %v", err)
+	}
+	if feed.Channel.Title != want {
+		t.Errorf("expected title %q but got %q", want, feed.Channel.Title)
+	}
+	if len(feed.Channel.Item) > 0 && feed.Channel.Item[0].Title != want {
+		t.Errorf("expected item title %q but got %q", want, feed.Channel.Item[0].Title)
+	}
+}
+
+func TestFetchFeedCharset(t *testing.T) {
+	title := "Новости науки"
+	data := encodeCharmap(t, "windows-1251", `<?xml version="1.0" encoding="windows-1251"?>`+
+		`<rss version="2.0"><channel><title>`+title+`</title></channel></rss>`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	feed, err := fetchFeed(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("failed to fetch feed: %v", err)
+	}
+	if feed.Channel.Title != title {
+		t.Errorf("expected title %q but got %q", title, feed.Channel.Title)
+	}
+}
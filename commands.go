@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -13,13 +15,15 @@ import (
 
 	"github.com/Kam1217/blog_aggregator/internal/config"
 	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/Kam1217/blog_aggregator/internal/migrate"
 	"github.com/google/uuid"
 )
 
 type state struct {
 	cfg        *config.Config
 	cfgManager *config.ConfigManager
-	db         *database.Queries
+	db         database.Querier
+	migrator   *migrate.Migrator
 }
 
 type command struct {
@@ -28,73 +32,42 @@ type command struct {
 }
 
 type commands struct {
-	registeredCommands map[string]func(*state, command) error
+	registeredCommands map[string]func(context.Context, *state, command) error
 }
 
-func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(s *state, cmd command) error {
-	return func(s *state, cmd command) error {
-		user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
-		if err != nil {
-			return fmt.Errorf("failed to get user: %w", err)
-		}
-		return handler(s, cmd, user)
-	}
-}
-
-func scrapeFeeds(s *state) error {
-	feed, err := s.db.GetNextFeedToFetch(context.Background())
-	if err != nil {
-		return fmt.Errorf("failed to fetch the next feed: %w", err)
-	}
-	_, err = s.db.MarkFeedFetched(context.Background(), feed.ID)
-	if err != nil {
-		return fmt.Errorf("failed to mark the fetched feed: %w", err)
-	}
-	data, err := fetchFeed(context.Background(), feed.Url)
-	if err != nil {
-		return fmt.Errorf("failed to make a HTTP request: %w", err)
-	}
-	for _, post := range data.Channel.Item {
-		t, err := time.Parse(time.RFC1123Z, post.PubDate)
-		if err != nil {
-			fmt.Printf("could not parse pubDate: %v\n", err)
-			continue
+// middlewareLoggedIn runs handler as the owner of the API token in
+// GATOR_TOKEN, which needs the given scope, or if that is not set as the user
+// logged in with login.
+func middlewareLoggedIn(scope string, handler func(ctx context.Context, s *state, cmd command, user database.User) error) func(ctx context.Context, s *state, cmd command) error {
+	return func(ctx context.Context, s *state, cmd command) error {
+		if token := os.Getenv(tokenEnv); token != "" {
+			user, scopes, err := authenticateToken(ctx, s, token)
+			if err != nil {
+				return fmt.Errorf("%s: %w", tokenEnv, err)
+			}
+			if !hasScope(scopes, scope) {
+				return fmt.Errorf("the API token in %s lacks the %s scope needed for %s", tokenEnv, scope, cmd.name)
+			}
+			return handler(ctx, s, cmd, user)
 		}
-		_, err = s.db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:        uuid.New(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Title:     post.Title,
-			Url:       post.Link,
-			Description: sql.NullString{
-				String: post.Description,
-				Valid:  true,
-			},
-			PublishedAt: t,
-			FeedID:      feed.ID,
-		})
+		user, err := s.db.GetUser(ctx, s.cfg.CurrentUserName)
 		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-				continue
-			}
-			log.Printf("Couldn't create post: %v", err)
-			continue
+			return fmt.Errorf("failed to get user: %w", err)
 		}
+		return handler(ctx, s, cmd, user)
 	}
-	return nil
 }
 
-func handlerLogin(s *state, cmd command) error {
+func handlerLogin(ctx context.Context, s *state, cmd command) error {
 	if len(cmd.args) == 0 {
 		return fmt.Errorf("login handler expects a single argument but got an empty slice")
 	}
-	_, err := s.db.GetUser(context.Background(), cmd.args[0])
+	_, err := s.db.GetUser(ctx, cmd.args[0])
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			os.Exit(1)
-		} else {
-			return fmt.Errorf("database error getting user: %w", err)
+			return fmt.Errorf("user %q does not exist", cmd.args[0])
 		}
+		return fmt.Errorf("database error getting user: %w", err)
 	}
 	if err := s.cfgManager.SetUser(s.cfg, cmd.args[0]); err != nil {
 		return fmt.Errorf("error setting the username to config: %w", err)
@@ -103,33 +76,50 @@ func handlerLogin(s *state, cmd command) error {
 	return nil
 }
 
-func (c *commands) run(s *state, cmd command) error {
+func (c *commands) run(ctx context.Context, s *state, cmd command) error {
 	handler, exists := c.registeredCommands[cmd.name]
 	if !exists {
 		return fmt.Errorf("command does not exist: %v", cmd.name)
 	}
-	if err := handler(s, cmd); err != nil {
+	if err := handler(ctx, s, cmd); err != nil {
 		return fmt.Errorf("error calling the command: %w", err)
 	}
 	return nil
 }
 
-func (c *commands) register(name string, f func(*state, command) error) {
+// parseFlags parses fs from args, allowing flags to appear before, between
+// or after positional arguments, and returns the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (c *commands) register(name string, f func(context.Context, *state, command) error) {
 	c.registeredCommands[name] = f
 }
 
-func handlerRegister(s *state, cmd command) error {
+func handlerRegister(ctx context.Context, s *state, cmd command) error {
 	if len(cmd.args) == 0 {
 		return fmt.Errorf("login handler expects a single argument but got an empty slice")
 	}
-	user, err := s.db.GetUser(context.Background(), cmd.args[0])
+	user, err := s.db.GetUser(ctx, cmd.args[0])
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
 	if user.Name != "" {
-		os.Exit(1)
+		return fmt.Errorf("user %q already exists", user.Name)
 	}
-	newUser, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
+	newUser, err := s.db.CreateUser(ctx, database.CreateUserParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -146,8 +136,8 @@ func handlerRegister(s *state, cmd command) error {
 	return nil
 }
 
-func handlerReset(s *state, _ command) error {
-	err := s.db.DeleteUsers(context.Background())
+func handlerReset(ctx context.Context, s *state, _ command) error {
+	err := s.db.DeleteUsers(ctx)
 	if err != nil {
 		return fmt.Errorf("error deleteing users: %w", err)
 	}
@@ -155,8 +145,8 @@ func handlerReset(s *state, _ command) error {
 	return nil
 }
 
-func handlerUsers(s *state, cmd command) error {
-	users, err := s.db.GetUsers(context.Background())
+func handlerUsers(ctx context.Context, s *state, cmd command) error {
+	users, err := s.db.GetUsers(ctx)
 	if err != nil {
 		return fmt.Errorf("error getting users: %w", err)
 	}
@@ -171,38 +161,151 @@ func handlerUsers(s *state, cmd command) error {
 	return nil
 }
 
-func handlerAgg(s *state, cmd command) error {
-	timeBetweenRequests, err := time.ParseDuration(cmd.args[0])
+func handlerAgg(ctx context.Context, s *state, cmd command) error {
+	fs := flag.NewFlagSet("agg", flag.ContinueOnError)
+	once := fs.Bool("once", false, "scrape every due feed once and exit")
+	concurrency := fs.Int("concurrency", 1, "number of feeds to scrape at the same time")
+	batchSize := fs.Int("batch", 0, "number of feeds to claim per tick (defaults to the concurrency)")
+	fetchTimeout := fs.Duration("timeout", fetchLimits.Timeout, "timeout for each feed fetch (overrides fetch_timeout)")
+	leaseDuration := fs.Duration("lease", defaultLeaseDuration, "how long a claimed feed stays reserved for this aggregator")
+	drainTimeout := fs.Duration("drain", defaultDrainTimeout, "how long in-flight fetches may finish after a shutdown signal")
+	args, err := parseFlags(fs, cmd.args)
 	if err != nil {
-		return fmt.Errorf("failed to set time between requests: %w", err)
+		return err
+	}
+	if !*once && len(args) != 1 {
+		return fmt.Errorf("agg command requires the time between requests, e.g. 1m, or --once")
+	}
+	var timeBetweenRequests time.Duration
+	if !*once {
+		timeBetweenRequests, err = time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to set time between requests: %w", err)
+		}
+		if timeBetweenRequests <= 0 {
+			return fmt.Errorf("time between requests must be positive")
+		}
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	if *batchSize < 1 {
+		*batchSize = *concurrency
 	}
-	fmt.Printf("Collecting feeds every %v\n", timeBetweenRequests)
+	if *leaseDuration < 3*time.Second {
+		return fmt.Errorf("lease must be at least 3s")
+	}
+	if *fetchTimeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	limits := fetchLimits
+	limits.Timeout = *fetchTimeout
+	setFetchLimits(limits)
+
+	opts := scrapeOptions{
+		batchSize:     *batchSize,
+		concurrency:   *concurrency,
+		fetchTimeout:  *fetchTimeout,
+		leaseDuration: *leaseDuration,
+		drainTimeout:  *drainTimeout,
+		workerID:      newWorkerID(),
+		maxFailures:   s.cfg.MaxFeedFailures,
+	}
+	if opts.maxFailures < 1 {
+		opts.maxFailures = config.DefaultMaxFeedFailures
+	}
+	if *once {
+		return scrapeDueFeeds(ctx, s, opts)
+	}
+
+	fmt.Printf("Collecting %d feeds every %v with %d workers\n", *batchSize, timeBetweenRequests, *concurrency)
 
 	ticker := time.NewTicker(timeBetweenRequests)
-	for ; ; <-ticker.C {
-		err = scrapeFeeds(s)
+	defer ticker.Stop()
+	for {
+		opts.dueBefore = time.Now()
+		if _, err := scrapeFeeds(ctx, s, opts); err != nil {
+			fmt.Printf("failed to scrape the feed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println("Stopped collecting feeds")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrapeDueFeeds scrapes every feed that is due right now exactly once and
+// reports an error if any of them failed.
+func scrapeDueFeeds(ctx context.Context, s *state, opts scrapeOptions) error {
+	opts.dueBefore = time.Now()
+	var errs []error
+	total := 0
+	for ctx.Err() == nil {
+		n, err := scrapeFeeds(ctx, s, opts)
 		if err != nil {
-			fmt.Printf("failed to scrape the feed: %v", err)
+			errs = append(errs, err)
+		}
+		if n == 0 {
+			break
 		}
+		total += n
 	}
+	if ctx.Err() != nil {
+		errs = append(errs, fmt.Errorf("interrupted: %w", ctx.Err()))
+	}
+	fmt.Printf("Scraped %d feeds\n", total)
+	return errors.Join(errs...)
 }
 
-func handlerAddFeed(s *state, cmd command, user database.User) error {
-	if len(cmd.args) != 2 {
-		return fmt.Errorf("add feed needs 2 arguments")
+func handlerAddFeed(ctx context.Context, s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("addfeed", flag.ContinueOnError)
+	noVerify := fs.Bool("no-verify", false, "add the feed without fetching it first")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+	var name, feedURL string
+	switch len(args) {
+	case 1:
+		feedURL = args[0]
+	case 2:
+		name, feedURL = args[0], args[1]
+	default:
+		return fmt.Errorf("usage: addfeed [name] <url> [--no-verify]")
+	}
+
+	if *noVerify {
+		if name == "" {
+			return fmt.Errorf("a feed name is required with --no-verify")
+		}
+	} else {
+		verifiedURL, verifiedName, err := verifyFeed(ctx, feedURL, name)
+		if err != nil {
+			return err
+		}
+		if verifiedURL != feedURL {
+			fmt.Printf("Found feed %s\n", verifiedURL)
+		}
+		if name == "" {
+			fmt.Printf("Using the feed's title as its name: %s\n", verifiedName)
+		}
+		feedURL, name = verifiedURL, verifiedName
 	}
-	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+
+	feed, err := s.db.CreateFeed(ctx, database.CreateFeedParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-		Name:      cmd.args[0],
-		Url:       cmd.args[1],
+		Name:      name,
+		Url:       feedURL,
 		UserID:    user.ID,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create feed: %w", err)
 	}
-	_, err = s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+	_, err = s.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -216,8 +319,139 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 	return nil
 }
 
-func handlerListFeeds(s *state, cmd command) error {
-	feeds, err := s.db.GetFeeds(context.Background())
+// verifyFeed resolves rawURL to a feed, test-fetches it and returns the feed
+// URL and the name to store, defaulting to the feed's own title.
+func verifyFeed(ctx context.Context, rawURL, name string) (string, string, error) {
+	feedURL, err := discoverFeedURL(ctx, rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find a feed at %s: %w", rawURL, err)
+	}
+	feed, err := fetchFeed(ctx, feedURL)
+	if err != nil {
+		return "", "", fmt.Errorf("%s is not a valid feed: %w (use --no-verify to add it anyway)", feedURL, err)
+	}
+	title := strings.TrimSpace(feed.Channel.Title)
+	if title == "" && len(feed.Channel.Item) == 0 {
+		return "", "", fmt.Errorf("%s does not look like a feed: it has no title and no items (use --no-verify to add it anyway)", feedURL)
+	}
+	if name == "" {
+		if title == "" {
+			return "", "", fmt.Errorf("%s has no title, give the feed a name: addfeed <name> <url>", feedURL)
+		}
+		name = title
+	}
+	return feedURL, name, nil
+}
+
+// feedSubcommandArgs is the number of arguments each feed subcommand takes,
+// the feed's URL first.
+var feedSubcommandArgs = map[string]int{
+	"rename":  2,
+	"set-url": 2,
+	"delete":  1,
+}
+
+func handlerFeed(ctx context.Context, s *state, cmd command, user database.User) error {
+	usage := fmt.Errorf("usage: feed rename <url> <new name> | feed set-url <url> <new url> [--no-verify] | feed delete <url>")
+	if len(cmd.args) == 0 {
+		return usage
+	}
+	subcommand := cmd.args[0]
+	wantArgs, ok := feedSubcommandArgs[subcommand]
+	if !ok {
+		return usage
+	}
+	fs := flag.NewFlagSet("feed "+subcommand, flag.ContinueOnError)
+	noVerify := new(bool)
+	if subcommand == "set-url" {
+		fs.BoolVar(noVerify, "no-verify", false, "change the URL without fetching the new one first")
+	}
+	args, err := parseFlags(fs, cmd.args[1:])
+	if err != nil {
+		return err
+	}
+	if len(args) != wantArgs {
+		return usage
+	}
+	feed, err := getOwnedFeed(ctx, s, user, args[0])
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "rename":
+		feed, err = s.db.RenameFeed(ctx, database.RenameFeedParams{
+			ID:     feed.ID,
+			UserID: user.ID,
+			Name:   args[1],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to rename feed: %w", err)
+		}
+		fmt.Printf("Renamed feed %s to %s\n", feed.Url, feed.Name)
+	case "set-url":
+		newURL := args[1]
+		if !*noVerify {
+			verifiedURL, _, err := verifyFeed(ctx, newURL, feed.Name)
+			if err != nil {
+				return err
+			}
+			if verifiedURL != newURL {
+				fmt.Printf("Found feed %s\n", verifiedURL)
+			}
+			newURL = verifiedURL
+		}
+		if _, err := s.db.GetFeedByURL(ctx, newURL); err == nil {
+			return fmt.Errorf("a feed with the URL %s already exists", newURL)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check the new URL: %w", err)
+		}
+		oldURL := feed.Url
+		feed, err = s.db.UpdateFeedURL(ctx, database.UpdateFeedURLParams{
+			ID:     feed.ID,
+			UserID: user.ID,
+			Url:    newURL,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to change feed URL: %w", err)
+		}
+		fmt.Printf("Moved feed %s from %s to %s\n", feed.Name, oldURL, feed.Url)
+	case "delete":
+		deleted, err := s.db.DeleteFeed(ctx, database.DeleteFeedParams{
+			ID:     feed.ID,
+			UserID: user.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete feed: %w", err)
+		}
+		if deleted == 0 {
+			return fmt.Errorf("feed %s was already deleted", feed.Url)
+		}
+		fmt.Printf("Deleted feed %s along with its follows and posts\n", feed.Name)
+	default:
+		return usage
+	}
+	return nil
+}
+
+// getOwnedFeed looks a feed up by URL and checks that user added it, since
+// only a feed's creator may change it.
+func getOwnedFeed(ctx context.Context, s *state, user database.User, feedURL string) (database.Feed, error) {
+	feed, err := s.db.GetFeedByURL(ctx, feedURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Feed{}, fmt.Errorf("no feed with the URL %s, see feeds for the list", feedURL)
+	}
+	if err != nil {
+		return database.Feed{}, fmt.Errorf("failed to get feed: %w", err)
+	}
+	if feed.UserID != user.ID {
+		return database.Feed{}, fmt.Errorf("feed %s was added by another user, only its creator can change it", feedURL)
+	}
+	return feed, nil
+}
+
+func handlerListFeeds(ctx context.Context, s *state, cmd command) error {
+	feeds, err := s.db.GetFeeds(ctx)
 	if err != nil {
 		return fmt.Errorf("error getting feeds: %w", err)
 	}
@@ -228,19 +462,36 @@ func handlerListFeeds(s *state, cmd command) error {
 		fmt.Printf("%s\n", feed.Name)
 		fmt.Printf("%s\n", feed.Url)
 		fmt.Printf("%s\n", feed.Name_2)
+		switch {
+		case !feed.LastFetchedAt.Valid:
+			fmt.Println("Never fetched")
+		case feed.LastStatus.Valid:
+			fmt.Printf("Last fetched: %s (HTTP %d)\n", feed.LastFetchedAt.Time.Format(time.RFC822), feed.LastStatus.Int32)
+		default:
+			fmt.Printf("Last fetched: %s\n", feed.LastFetchedAt.Time.Format(time.RFC822))
+		}
+		if feed.ConsecutiveFailures > 0 {
+			fmt.Printf("Failed %d times in a row: %s\n", feed.ConsecutiveFailures, feed.LastError.String)
+		}
+		if feed.DisabledAt.Valid {
+			fmt.Printf("Disabled since %s\n", feed.DisabledAt.Time.Format(time.RFC822))
+		} else if feed.NextFetchAt.Valid {
+			fmt.Printf("Retrying after %s\n", feed.NextFetchAt.Time.Format(time.RFC822))
+		}
+		fmt.Println()
 	}
 	return nil
 }
 
-func handlerFollow(s *state, cmd command, user database.User) error {
+func handlerFollow(ctx context.Context, s *state, cmd command, user database.User) error {
 	if len(cmd.args) != 1 {
 		return fmt.Errorf("follow command requires 1 argument")
 	}
-	feed, err := s.db.GetFeedByURL(context.Background(), cmd.args[0])
+	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
 	if err != nil {
 		return fmt.Errorf("failed to get feed by url")
 	}
-	feedFollow, err := s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+	feedFollow, err := s.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -254,8 +505,8 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 	return nil
 }
 
-func handlerFollowing(s *state, cmd command, user database.User) error {
-	follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+func handlerFollowing(ctx context.Context, s *state, cmd command, user database.User) error {
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
 	if err != nil {
 		return fmt.Errorf("failed to get follows: %w", err)
 	}
@@ -264,17 +515,21 @@ func handlerFollowing(s *state, cmd command, user database.User) error {
 		return nil
 	}
 	for _, follow := range follows {
-		fmt.Println(follow.FeedName)
+		if follow.Category.Valid {
+			fmt.Printf("%s [%s] (%d unread)\n", follow.FeedName, follow.Category.String, follow.UnreadCount)
+			continue
+		}
+		fmt.Printf("%s (%d unread)\n", follow.FeedName, follow.UnreadCount)
 	}
 	return nil
 }
 
-func handlerUnfollow(s *state, cmd command, user database.User) error {
-	feed, err := s.db.GetFeedByURL(context.Background(), cmd.args[0])
+func handlerUnfollow(ctx context.Context, s *state, cmd command, user database.User) error {
+	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
 	if err != nil {
 		return fmt.Errorf("failed to get feed by url")
 	}
-	err = s.db.DeleteFollows(context.Background(), database.DeleteFollowsParams{
+	err = s.db.DeleteFollows(ctx, database.DeleteFollowsParams{
 		UserID: user.ID,
 		FeedID: feed.ID,
 	})
@@ -285,32 +540,460 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 	return nil
 }
 
-func handlerBrowse(s *state, cmd command) error {
+func handlerBrowse(ctx context.Context, s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("browse", flag.ContinueOnError)
+	unreadOnly := fs.Bool("unread", false, "only show posts you have not read yet")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
 	limit := 2 // default
-	if len(cmd.args) > 0 {
-		if l, err := strconv.Atoi(cmd.args[0]); err == nil {
+	if len(args) > 0 {
+		if l, err := strconv.Atoi(args[0]); err == nil {
 			limit = l
 		}
 	}
 
-	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
+	posts, err := s.db.GetPostForUser(ctx, database.GetPostForUserParams{
+		UserID:     user.ID,
+		UnreadOnly: *unreadOnly,
+		Limit:      int32(limit),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to get posts for user: %w", err)
 	}
-	posts, err := s.db.GetPostForUser(context.Background(), database.GetPostForUserParams{
-		UserID: user.ID,
-		Limit:  int32(limit),
-	})
 	if len(posts) == 0 {
 		fmt.Println("No posts to browse. Try following some feeds!")
 		return nil
 	}
+	for _, post := range posts {
+		date := post.PublishedAt.Format(time.RFC822)
+		if post.PublishedAtSynthesized {
+			date += " (estimated)"
+		}
+		fmt.Printf("ID: %s\nTitle: %s\nFeed: %s\nDate: %s\nURL: %s\n\n",
+			post.ID, post.Title, post.FeedName, date, post.Url)
+	}
+	return nil
+}
+
+func handlerSearch(ctx context.Context, s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "only search posts from the feed with this url")
+	since := fs.String("since", "", "only search posts published after a date (2006-01-02) or within a duration (36h, 7d)")
+	limit := fs.Int("limit", 10, "maximum number of results")
+	args, err := parseFlags(fs, cmd.args)
 	if err != nil {
-		return fmt.Errorf("failed to get posts for user: %w", err)
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("search command requires a query, e.g. search '\"rust async\" -tokio'")
+	}
+
+	params := database.SearchPostsForUserParams{
+		Query:      strings.Join(args, " "),
+		UserID:     user.ID,
+		FeedUrl:    sql.NullString{String: *feedURL, Valid: *feedURL != ""},
+		MaxResults: int32(*limit),
+	}
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		params.Since = sql.NullTime{Time: t, Valid: true}
+	}
+	posts, err := s.db.SearchPostsForUser(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to search posts: %w", err)
+	}
+	if len(posts) == 0 {
+		fmt.Println("No posts match your search")
+		return nil
 	}
 	for _, post := range posts {
-		fmt.Printf("Title: %s\nFeed: %s\nDate: %s\nURL: %s\n\n",
-			post.Title, post.FeedName, post.PublishedAt.Format(time.RFC822), post.Url)
+		fmt.Printf("Title: %s\nFeed: %s\nDate: %s\nURL: %s\n%s\n\n",
+			post.Title, post.FeedName, post.PublishedAt.Format(time.RFC822), post.Url, post.Snippet)
+	}
+	return nil
+}
+
+// parseSince reads a --since value, which is either a date or a duration
+// back from now. Durations may use a d suffix for days; negative ones, which
+// would point into the future, are rejected.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := parsePubDate(value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("could not understand --since %q, use a date like 2006-01-02 or a duration like 7d", value)
+}
+
+func handlerMarkRead(ctx context.Context, s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("mark-read", flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "mark every post of the feed with this url as read")
+	before := fs.String("before", "", "mark every post published before a date (2006-01-02) or older than a duration (36h, 7d) as read")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *feedURL != "":
+		feed, err := s.db.GetFeedByURL(ctx, *feedURL)
+		if err != nil {
+			return fmt.Errorf("failed to get feed by url: %w", err)
+		}
+		n, err := s.db.MarkFeedRead(ctx, database.MarkFeedReadParams{UserID: user.ID, FeedID: feed.ID})
+		if err != nil {
+			return fmt.Errorf("failed to mark feed as read: %w", err)
+		}
+		fmt.Printf("marked %d posts from %s as read\n", n, feed.Name)
+	case *before != "":
+		t, err := parseSince(*before, time.Now())
+		if err != nil {
+			return err
+		}
+		n, err := s.db.MarkPostsReadBefore(ctx, database.MarkPostsReadBeforeParams{UserID: user.ID, Before: t})
+		if err != nil {
+			return fmt.Errorf("failed to mark posts as read: %w", err)
+		}
+		fmt.Printf("marked %d posts published before %s as read\n", n, t.Format(time.RFC822))
+	default:
+		ids, err := parsePostIDs(args)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := s.db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: user.ID, PostID: id}); err != nil {
+				return fmt.Errorf("failed to mark post %s as read: %w", id, err)
+			}
+		}
+		fmt.Printf("marked %d posts as read\n", len(ids))
+	}
+	return nil
+}
+
+func handlerMarkUnread(ctx context.Context, s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("mark-unread", flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "mark every post of the feed with this url as unread")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if *feedURL != "" {
+		feed, err := s.db.GetFeedByURL(ctx, *feedURL)
+		if err != nil {
+			return fmt.Errorf("failed to get feed by url: %w", err)
+		}
+		n, err := s.db.MarkFeedUnread(ctx, database.MarkFeedUnreadParams{UserID: user.ID, FeedID: feed.ID})
+		if err != nil {
+			return fmt.Errorf("failed to mark feed as unread: %w", err)
+		}
+		fmt.Printf("marked %d posts from %s as unread\n", n, feed.Name)
+		return nil
+	}
+	ids, err := parsePostIDs(args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.db.MarkPostUnread(ctx, database.MarkPostUnreadParams{UserID: user.ID, PostID: id}); err != nil {
+			return fmt.Errorf("failed to mark post %s as unread: %w", id, err)
+		}
+	}
+	fmt.Printf("marked %d posts as unread\n", len(ids))
+	return nil
+}
+
+func parsePostIDs(args []string) ([]uuid.UUID, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected one or more post IDs as shown by browse")
+	}
+	ids := make([]uuid.UUID, 0, len(args))
+	for _, arg := range args {
+		id, err := uuid.Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid post ID %q: %w", arg, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func handlerSave(ctx context.Context, s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("save command requires a post ID and an optional note")
+	}
+	postID, err := uuid.Parse(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("invalid post ID %q: %w", cmd.args[0], err)
+	}
+	note := strings.Join(cmd.args[1:], " ")
+	saved, err := s.db.SavePost(ctx, database.SavePostParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		Note:      sql.NullString{String: note, Valid: note != ""},
+		PostID:    postID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("there is no post with ID %s", postID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save post: %w", err)
+	}
+	fmt.Printf("saved %s\n", saved.Title)
+	return nil
+}
+
+func handlerUnsave(ctx context.Context, s *state, cmd command, user database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("unsave command requires the post ID or url of a saved post")
+	}
+	n, err := s.db.DeleteSavedPost(ctx, database.DeleteSavedPostParams{
+		UserID: user.ID,
+		Ref:    cmd.args[0],
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unsave post: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("no saved post matches %s", cmd.args[0])
+	}
+	fmt.Println("succesfully unsaved post")
+	return nil
+}
+
+// savedPostExport is the shape of a saved post in saved --format json.
+type savedPostExport struct {
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Feed        string    `json:"feed"`
+	PublishedAt time.Time `json:"published_at"`
+	SavedAt     time.Time `json:"saved_at"`
+	Note        string    `json:"note,omitempty"`
+}
+
+// likeEscaper escapes the LIKE wildcards in a search term so it is matched
+// literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func handlerSaved(ctx context.Context, s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("saved", flag.ContinueOnError)
+	search := fs.String("search", "", "only list saved posts whose title, description or note contains this text")
+	format := fs.String("format", "text", "output format: text, json or markdown")
+	if _, err := parseFlags(fs, cmd.args); err != nil {
+		return err
+	}
+
+	saved, err := s.db.GetSavedPostsForUser(ctx, database.GetSavedPostsForUserParams{
+		UserID: user.ID,
+		Search: sql.NullString{String: likeEscaper.Replace(*search), Valid: *search != ""},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get saved posts: %w", err)
+	}
+
+	switch *format {
+	case "text":
+		if len(saved) == 0 {
+			fmt.Println("No saved posts. Save one with: save <post_id> [note]")
+			return nil
+		}
+		for _, post := range saved {
+			fmt.Printf("Title: %s\nFeed: %s\nDate: %s\nURL: %s\n",
+				post.Title, post.FeedName, post.PublishedAt.Format(time.RFC822), post.Url)
+			if post.Note.Valid {
+				fmt.Printf("Note: %s\n", post.Note.String)
+			}
+			fmt.Println()
+		}
+	case "json":
+		export := make([]savedPostExport, 0, len(saved))
+		for _, post := range saved {
+			export = append(export, savedPostExport{
+				Title:       post.Title,
+				URL:         post.Url,
+				Feed:        post.FeedName,
+				PublishedAt: post.PublishedAt,
+				SavedAt:     post.CreatedAt,
+				Note:        post.Note.String,
+			})
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(export); err != nil {
+			return fmt.Errorf("failed to encode saved posts: %w", err)
+		}
+	case "markdown":
+		fmt.Println("# Saved posts")
+		fmt.Println()
+		for _, post := range saved {
+			fmt.Printf("- [%s](%s) — %s, %s\n", post.Title, post.Url, post.FeedName, post.PublishedAt.Format("2006-01-02"))
+			if post.Note.Valid {
+				fmt.Printf("  > %s\n", post.Note.String)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format %q, use text, json or markdown", *format)
+	}
+	return nil
+}
+
+func handlerImportOPML(ctx context.Context, s *state, cmd command, user database.User) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("usage: import-opml <file>")
+	}
+	file, err := os.Open(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open OPML file: %w", err)
+	}
+	defer file.Close()
+	subs, err := parseOPML(file)
+	if err != nil {
+		return err
+	}
+
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get follows: %w", err)
+	}
+	following := make(map[string]bool, len(follows))
+	for _, follow := range follows {
+		following[follow.FeedUrl] = true
+	}
+	feeds, err := s.db.GetFeeds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get feeds: %w", err)
+	}
+	names := make(map[string]bool, len(feeds))
+	for _, feed := range feeds {
+		names[feed.Name] = true
+	}
+
+	// Feeds the user already follows, feeds created by the import and feeds
+	// that already existed and are now followed.
+	var followed, created, existing int
+	var failed []string
+	for _, sub := range subs {
+		if following[sub.URL] {
+			followed++
+			continue
+		}
+		isNew := false
+		feed, err := s.db.GetFeedByURL(ctx, sub.URL)
+		if errors.Is(err, sql.ErrNoRows) {
+			isNew = true
+			feed, err = s.db.CreateFeed(ctx, database.CreateFeedParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				Name:      uniqueFeedName(sub.Name, sub.URL, names),
+				Url:       sub.URL,
+				UserID:    user.ID,
+			})
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s): %v", sub.Name, sub.URL, err))
+			continue
+		}
+		_, err = s.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+			Category:  sql.NullString{String: sub.Category, Valid: sub.Category != ""},
+		})
+		if err != nil {
+			// Remove the feed created above so a failed follow does not
+			// leave a feed nobody follows behind.
+			if isNew {
+				if _, delErr := s.db.DeleteFeed(ctx, database.DeleteFeedParams{ID: feed.ID, UserID: user.ID}); delErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to remove the new feed: %w", delErr))
+				}
+			}
+			failed = append(failed, fmt.Sprintf("%s (%s): %v", sub.Name, sub.URL, err))
+			continue
+		}
+		following[sub.URL] = true
+		names[feed.Name] = true
+		if isNew {
+			created++
+		} else {
+			existing++
+		}
+	}
+
+	fmt.Printf("Imported %d feeds: %d created, %d already existed, %d already followed, %d failed\n",
+		len(subs), created, existing, followed, len(failed))
+	for _, f := range failed {
+		fmt.Printf("  failed: %s\n", f)
+	}
+	return nil
+}
+
+// uniqueFeedName returns name, or name suffixed with the feed's host or a
+// number if another feed already has it, since feed names are unique.
+func uniqueFeedName(name, feedURL string, taken map[string]bool) string {
+	if !taken[name] {
+		return name
+	}
+	if u, err := url.Parse(feedURL); err == nil && u.Host != "" {
+		if withHost := fmt.Sprintf("%s (%s)", name, u.Host); !taken[withHost] {
+			return withHost
+		}
+	}
+	for i := 2; ; i++ {
+		if numbered := fmt.Sprintf("%s (%d)", name, i); !taken[numbered] {
+			return numbered
+		}
+	}
+}
+
+func handlerExportOPML(ctx context.Context, s *state, cmd command, user database.User) error {
+	if len(cmd.args) > 1 {
+		return fmt.Errorf("usage: export-opml [file]")
+	}
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get follows: %w", err)
+	}
+	subs := make([]opmlSubscription, 0, len(follows))
+	for _, follow := range follows {
+		subs = append(subs, opmlSubscription{
+			Name:     follow.FeedName,
+			URL:      follow.FeedUrl,
+			Category: follow.Category.String,
+		})
+	}
+
+	title := fmt.Sprintf("%s's subscriptions", user.Name)
+	dateCreated := time.Now().Format(time.RFC1123Z)
+	if len(cmd.args) == 0 {
+		return writeOPML(os.Stdout, title, dateCreated, subs)
+	}
+	file, err := os.Create(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("failed to create OPML file: %w", err)
+	}
+	if err := writeOPML(file, title, dateCreated, subs); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write OPML file: %w", err)
 	}
+	fmt.Printf("Exported %d feeds to %s\n", len(subs), cmd.args[0])
 	return nil
 }
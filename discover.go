@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// feedLinkTypes are the <link rel="alternate"> types that point at a feed.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are probed, relative to the site root, when a page does
+// not advertise its feed.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml"}
+
+var (
+	htmlLinkTag = regexp.MustCompile(`(?is)<(link|base)\b[^>]*>`)
+	htmlAttr    = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// errMultipleFeeds is returned by discoverFeedURL when a page links to more
+// than one feed and the user has to pick one.
+var errMultipleFeeds = errors.New("multiple feeds found")
+
+// discoverFeedURL returns the feed to subscribe to for rawURL. Feeds are
+// returned as they are; for an HTML page the feeds it advertises with
+// <link rel="alternate"> are used, falling back to commonFeedPaths.
+func discoverFeedURL(ctx context.Context, rawURL string) (string, error) {
+	pageURL, contentType, data, err := fetchDocument(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	if !isHTML(contentType, data) {
+		return rawURL, nil
+	}
+
+	candidates := findFeedLinks(pageURL, data)
+	if len(candidates) == 0 {
+		candidates = probeFeedPaths(ctx, pageURL)
+	}
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%s is a web page and no feed was found on it", rawURL)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("%w on %s, run addfeed again with one of:\n  %s",
+			errMultipleFeeds, rawURL, strings.Join(candidates, "\n  "))
+	}
+}
+
+// fetchDocument GETs rawURL and returns the URL it was finally served from,
+// after redirects, so relative links can be resolved against it.
+func fetchDocument(ctx context.Context, rawURL string) (*url.URL, string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to get the new request: %w", err)
+	}
+	req.Header.Set("User-Agent", "gator")
+
+	client := newFetchClient(nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", nil, fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed ot read the response: %w", err)
+	}
+	return resp.Request.URL, resp.Header.Get("Content-Type"), data, nil
+}
+
+func isHTML(contentType string, data []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return true
+	case err == nil && mediaType != "text/plain" && mediaType != "application/octet-stream":
+		return false
+	}
+	// Missing or generic Content-Type: sniff the body.
+	return strings.HasPrefix(http.DetectContentType(data), "text/html")
+}
+
+// findFeedLinks returns the absolute URLs of the feeds a page advertises,
+// honouring <base href> and dropping duplicates.
+func findFeedLinks(pageURL *url.URL, data []byte) []string {
+	base := pageURL
+	var links []string
+	seen := map[string]bool{}
+	for _, tag := range htmlLinkTag.FindAllSubmatch(data, -1) {
+		attrs := map[string]string{}
+		for _, attr := range htmlAttr.FindAllSubmatch(tag[0], -1) {
+			attrs[strings.ToLower(string(attr[1]))] = string(attr[2]) + string(attr[3]) + string(attr[4])
+		}
+		href := strings.TrimSpace(attrs["href"])
+		if href == "" {
+			continue
+		}
+
+		if strings.EqualFold(string(tag[1]), "base") {
+			if u, err := pageURL.Parse(href); err == nil {
+				base = u
+			}
+			continue
+		}
+		if !hasToken(attrs["rel"], "alternate") {
+			continue
+		}
+		mediaType, _, _ := mime.ParseMediaType(attrs["type"])
+		if !feedLinkTypes[mediaType] {
+			continue
+		}
+
+		u, err := base.Parse(href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			links = append(links, u.String())
+		}
+	}
+	return links
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeFeedPaths tries commonFeedPaths on the page's site and returns the
+// ones that serve a parsable feed.
+func probeFeedPaths(ctx context.Context, pageURL *url.URL) []string {
+	var found []string
+	for _, path := range commonFeedPaths {
+		candidate := pageURL.ResolveReference(&url.URL{Path: path})
+		_, contentType, data, err := fetchDocument(ctx, candidate.String())
+		if err != nil || isHTML(contentType, data) {
+			continue
+		}
+		if _, err := parseFeed(contentType, data); err != nil {
+			continue
+		}
+		found = append(found, candidate.String())
+	}
+	return found
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDiscoverFeedURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blog/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!DOCTYPE html><html><head>
+<link rel="stylesheet" href="/style.css">
+<LINK REL="alternate" TYPE="application/rss+xml" title="Posts" href='feed.xml'>
+</head><body></body></html>`))
+	})
+	mux.HandleFunc("/multi", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head>
+<base href="https://example.com/">
+<link rel="alternate" type="application/atom+xml" href="/atom.xml">
+<link rel="alternate" type="application/feed+json" href="feed.json">
+</head></html>`))
+	})
+	mux.HandleFunc("/bare", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>No links</title></head></html>`))
+	})
+	mux.HandleFunc("/rss.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss version="2.0"><channel><title>Probed</title></channel></rss>`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+
+	t.Run("link tag", func(t *testing.T) {
+		got, err := discoverFeedURL(ctx, server.URL+"/blog/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := server.URL + "/blog/feed.xml"; got != want {
+			t.Errorf("expected %s but got %s", want, got)
+		}
+	})
+
+	t.Run("feed URL", func(t *testing.T) {
+		got, err := discoverFeedURL(ctx, server.URL+"/rss.xml")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != server.URL+"/rss.xml" {
+			t.Errorf("expected the feed URL unchanged but got %s", got)
+		}
+	})
+
+	t.Run("common paths", func(t *testing.T) {
+		got, err := discoverFeedURL(ctx, server.URL+"/bare")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := server.URL + "/rss.xml"; got != want {
+			t.Errorf("expected %s but got %s", want, got)
+		}
+	})
+
+	t.Run("several candidates", func(t *testing.T) {
+		_, err := discoverFeedURL(ctx, server.URL+"/multi")
+		if !errors.Is(err, errMultipleFeeds) {
+			t.Fatalf("expected errMultipleFeeds but got %v", err)
+		}
+		pageURL, _ := url.Parse(server.URL + "/multi/")
+		links := findFeedLinks(pageURL, []byte(`<base href="https://example.com/">
+<link rel="alternate" type="application/atom+xml" href="/atom.xml">
+<link rel="alternate" type="application/feed+json" href="feed.json">`))
+		if len(links) != 2 || links[0] != "https://example.com/atom.xml" || links[1] != "https://example.com/feed.json" {
+			t.Errorf("unexpected candidates: %v", links)
+		}
+	})
+}
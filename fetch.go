@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/config"
+)
+
+var (
+	errFeedTooLarge = errors.New("feed too large")
+	errNotAFeed     = errors.New("not a feed")
+)
+
+// fetchLimits bound every request gator makes for a feed. main sets them
+// from the config file with setFetchLimits before anything is fetched.
+var (
+	fetchLimits    = config.DefaultFetchLimits()
+	fetchTransport = newFetchTransport(fetchLimits)
+)
+
+func setFetchLimits(limits config.FetchLimits) {
+	fetchLimits = limits
+	fetchTransport = newFetchTransport(limits)
+}
+
+func newFetchTransport(limits config.FetchLimits) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   limits.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = limits.ConnectTimeout
+	transport.ResponseHeaderTimeout = limits.ReadTimeout
+	return transport
+}
+
+// newFetchClient returns a client that enforces fetchLimits, with
+// checkRedirect as its redirect policy (nil for the default one).
+func newFetchClient(checkRedirect func(*http.Request, []*http.Request) error) *http.Client {
+	return &http.Client{
+		Transport:     fetchTransport,
+		Timeout:       fetchLimits.Timeout,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// readBody reads a response body of at most fetchLimits.MaxBodyBytes, giving
+// up when the server sends nothing for fetchLimits.ReadTimeout.
+func readBody(resp *http.Response) ([]byte, error) {
+	limit := fetchLimits.MaxBodyBytes
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", errFeedTooLarge, resp.ContentLength, limit)
+	}
+
+	var timedOut atomic.Bool
+	idle := time.AfterFunc(fetchLimits.ReadTimeout, func() {
+		timedOut.Store(true)
+		resp.Body.Close()
+	})
+	defer idle.Stop()
+	body := &idleReader{r: resp.Body, idle: idle, timeout: fetchLimits.ReadTimeout}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if timedOut.Load() {
+		return nil, fmt.Errorf("no data received for %s", fetchLimits.ReadTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", errFeedTooLarge, limit)
+	}
+	return data, nil
+}
+
+// idleReader pushes idle back after every read that returns data.
+type idleReader struct {
+	r       io.Reader
+	idle    *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.idle.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// checkFeedContentType rejects responses that are obviously not feeds, going
+// by the Content-Type header and by sniffing the body.
+func checkFeedContentType(contentType string, data []byte) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if isBinaryMediaType(mediaType) {
+		return fmt.Errorf("%w: the server sent %s", errNotAFeed, mediaType)
+	}
+	if sniffed := http.DetectContentType(data); isBinaryMediaType(strings.SplitN(sniffed, ";", 2)[0]) {
+		return fmt.Errorf("%w: the response looks like %s", errNotAFeed, sniffed)
+	}
+	return nil
+}
+
+func isBinaryMediaType(mediaType string) bool {
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	switch mediaType {
+	case "application/zip", "application/x-zip-compressed", "application/gzip", "application/x-gzip",
+		"application/x-rar-compressed", "application/vnd.rar", "application/x-7z-compressed",
+		"application/pdf", "application/wasm":
+		return true
+	}
+	return false
+}
@@ -3,12 +3,117 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxFeedFailures     = 10
+	DefaultFetchConnectTimeout = 10 * time.Second
+	DefaultFetchReadTimeout    = 30 * time.Second
+	DefaultFetchTimeout        = 30 * time.Second
+	DefaultMaxFeedBytes        = 10 << 20
+)
+
+// Database drivers, as registered with database/sql.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
 )
 
 type Config struct {
+	// DbURL is a postgres:// connection URL, or sqlite://path for a local
+	// SQLite database file.
 	DbURL           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	// MaxFeedFailures is how many fetches in a row may fail before agg
+	// disables a feed. Zero means DefaultMaxFeedFailures.
+	MaxFeedFailures int `json:"max_feed_failures,omitempty"`
+	// Fetch timeouts are Go durations such as "10s"; empty means the
+	// matching default. FetchReadTimeout applies to waiting for the response
+	// headers and to every read of the body after that.
+	FetchConnectTimeout string `json:"fetch_connect_timeout,omitempty"`
+	FetchReadTimeout    string `json:"fetch_read_timeout,omitempty"`
+	FetchTimeout        string `json:"fetch_timeout,omitempty"`
+	// MaxFeedBytes is the largest feed body gator downloads. Zero means
+	// DefaultMaxFeedBytes.
+	MaxFeedBytes int64 `json:"max_feed_bytes,omitempty"`
+}
+
+// Database returns the database/sql driver and data source name to open
+// DbURL with. A sqlite:// URL names a file, relative to the working
+// directory ("sqlite://gator.db") or absolute ("sqlite:///home/me/gator.db");
+// foreign keys are enforced on its connections, which SQLite leaves off by
+// default.
+func (c *Config) Database() (driver, dataSource string, err error) {
+	path, ok := strings.CutPrefix(c.DbURL, "sqlite://")
+	if !ok {
+		return DriverPostgres, c.DbURL, nil
+	}
+	path, query, _ := strings.Cut(path, "?")
+	if path == "" {
+		return "", "", fmt.Errorf("invalid db_url %q: missing the database file path", c.DbURL)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid db_url %q: %w", c.DbURL, err)
+	}
+	params.Set("_foreign_keys", "1")
+	if !params.Has("_busy_timeout") {
+		params.Set("_busy_timeout", "5000")
+	}
+	return DriverSQLite, "file:" + path + "?" + params.Encode(), nil
+}
+
+// FetchLimits bound every HTTP request made to fetch a feed.
+type FetchLimits struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Timeout        time.Duration
+	MaxBodyBytes   int64
+}
+
+func DefaultFetchLimits() FetchLimits {
+	return FetchLimits{
+		ConnectTimeout: DefaultFetchConnectTimeout,
+		ReadTimeout:    DefaultFetchReadTimeout,
+		Timeout:        DefaultFetchTimeout,
+		MaxBodyBytes:   DefaultMaxFeedBytes,
+	}
+}
+
+// FetchLimits returns the configured fetch limits, using the defaults for
+// the ones that are not set.
+func (c *Config) FetchLimits() (FetchLimits, error) {
+	limits := DefaultFetchLimits()
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"fetch_connect_timeout", c.FetchConnectTimeout, &limits.ConnectTimeout},
+		{"fetch_read_timeout", c.FetchReadTimeout, &limits.ReadTimeout},
+		{"fetch_timeout", c.FetchTimeout, &limits.Timeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed <= 0 {
+			return FetchLimits{}, fmt.Errorf("invalid %s %q: must be a positive duration such as \"30s\"", d.name, d.value)
+		}
+		*d.dst = parsed
+	}
+	if c.MaxFeedBytes < 0 {
+		return FetchLimits{}, fmt.Errorf("invalid max_feed_bytes %d: must be positive", c.MaxFeedBytes)
+	}
+	if c.MaxFeedBytes > 0 {
+		limits.MaxBodyBytes = c.MaxFeedBytes
+	}
+	return limits, nil
 }
 
 type ConfigManager struct {
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestReadConfig(t *testing.T) {
@@ -37,3 +38,56 @@ func TestReadConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestFetchLimits(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		limits, err := (&Config{}).FetchLimits()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if limits != DefaultFetchLimits() {
+			t.Errorf("FetchLimits got %+v, want the defaults %+v", limits, DefaultFetchLimits())
+		}
+	})
+	t.Run("configured", func(t *testing.T) {
+		conf := &Config{FetchConnectTimeout: "2s", FetchReadTimeout: "5s", FetchTimeout: "1m", MaxFeedBytes: 1024}
+		limits, err := conf.FetchLimits()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := FetchLimits{ConnectTimeout: 2 * time.Second, ReadTimeout: 5 * time.Second, Timeout: time.Minute, MaxBodyBytes: 1024}
+		if limits != want {
+			t.Errorf("FetchLimits got %+v, want %+v", limits, want)
+		}
+	})
+	t.Run("invalid duration", func(t *testing.T) {
+		if _, err := (&Config{FetchTimeout: "soon"}).FetchLimits(); err == nil {
+			t.Errorf("expected error for invalid fetch_timeout, got nil")
+		}
+	})
+}
+
+func TestDatabase(t *testing.T) {
+	tests := []struct {
+		dbURL      string
+		driver     string
+		dataSource string
+	}{
+		{"postgres://gator@localhost:5432/gator?sslmode=disable", DriverPostgres, "postgres://gator@localhost:5432/gator?sslmode=disable"},
+		{"sqlite://gator.db", DriverSQLite, "file:gator.db?_busy_timeout=5000&_foreign_keys=1"},
+		{"sqlite:///home/me/gator.db?_journal_mode=WAL", DriverSQLite, "file:/home/me/gator.db?_busy_timeout=5000&_foreign_keys=1&_journal_mode=WAL"},
+	}
+	for _, tt := range tests {
+		driver, dataSource, err := (&Config{DbURL: tt.dbURL}).Database()
+		if err != nil {
+			t.Errorf("Database(%q) returned error: %v", tt.dbURL, err)
+			continue
+		}
+		if driver != tt.driver || dataSource != tt.dataSource {
+			t.Errorf("Database(%q) got %q, %q, want %q, %q", tt.dbURL, driver, dataSource, tt.driver, tt.dataSource)
+		}
+	}
+	if _, _, err := (&Config{DbURL: "sqlite://"}).Database(); err == nil {
+		t.Errorf("expected error for a sqlite URL without a path")
+	}
+}
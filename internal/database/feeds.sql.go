@@ -7,11 +7,82 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET lease_owner = $1::text,
+    lease_expires_at = NOW() + make_interval(secs => $2::int),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (lease_expires_at IS NULL OR lease_expires_at < NOW())
+        AND disabled_at IS NULL
+        AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+        AND (last_fetched_at IS NULL OR last_fetched_at < $3::timestamptz)
+    ORDER BY last_fetched_at ASC NULLS FIRST
+    LIMIT $4
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_owner, lease_expires_at, last_error, last_status, consecutive_failures, next_fetch_at, disabled_at
+`
+
+type ClaimFeedsToFetchParams struct {
+	LeaseOwner   string
+	LeaseSeconds int32
+	DueBefore    time.Time
+	BatchSize    int32
+}
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch,
+		arg.LeaseOwner,
+		arg.LeaseSeconds,
+		arg.DueBefore,
+		arg.BatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.LastError,
+			&i.LastStatus,
+			&i.ConsecutiveFailures,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
 VALUES (
@@ -22,7 +93,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_owner, lease_expires_at, last_error, last_status, consecutive_failures, next_fetch_at, disabled_at
 `
 
 type CreateFeedParams struct {
@@ -52,12 +123,58 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
+const deleteFeed = `-- name: DeleteFeed :execrows
+DELETE FROM feeds WHERE id = $1 AND user_id = $2
+`
+
+type DeleteFeedParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteFeed(ctx context.Context, arg DeleteFeedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeed, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const extendFeedLease = `-- name: ExtendFeedLease :execrows
+UPDATE feeds
+SET lease_expires_at = NOW() + make_interval(secs => $1::int)
+WHERE id = $2 AND lease_owner = $3::text
+`
+
+type ExtendFeedLeaseParams struct {
+	LeaseSeconds int32
+	ID           uuid.UUID
+	LeaseOwner   string
+}
+
+func (q *Queries) ExtendFeedLease(ctx context.Context, arg ExtendFeedLeaseParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, extendFeedLease, arg.LeaseSeconds, arg.ID, arg.LeaseOwner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds WHERE url = $1
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_owner, lease_expires_at, last_error, last_status, consecutive_failures, next_fetch_at, disabled_at FROM feeds WHERE url = $1
 `
 
 func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
@@ -71,20 +188,38 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT feeds.name, feeds.url, users.name FROM feeds
+SELECT feeds.id, feeds.name, feeds.url, users.name, feeds.last_fetched_at, feeds.last_status,
+    feeds.last_error, feeds.consecutive_failures, feeds.next_fetch_at, feeds.disabled_at
+FROM feeds
 INNER JOIN users
 ON feeds.user_id = users.id
 `
 
 type GetFeedsRow struct {
-	Name   string
-	Url    string
-	Name_2 string
+	ID                  uuid.UUID
+	Name                string
+	Url                 string
+	Name_2              string
+	LastFetchedAt       sql.NullTime
+	LastStatus          sql.NullInt32
+	LastError           sql.NullString
+	ConsecutiveFailures int32
+	NextFetchAt         sql.NullTime
+	DisabledAt          sql.NullTime
 }
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
@@ -96,7 +231,18 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 	var items []GetFeedsRow
 	for rows.Next() {
 		var i GetFeedsRow
-		if err := rows.Scan(&i.Name, &i.Url, &i.Name_2); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.Name_2,
+			&i.LastFetchedAt,
+			&i.LastStatus,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -110,14 +256,37 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const markFeedFetchFailed = `-- name: MarkFeedFetchFailed :one
+UPDATE feeds
+SET last_fetched_at = NOW(), updated_at = NOW(), lease_owner = NULL, lease_expires_at = NULL,
+    last_error = $1::text,
+    last_status = $2,
+    consecutive_failures = consecutive_failures + 1,
+    next_fetch_at = NOW() + make_interval(secs => $3::int),
+    disabled_at = CASE
+        WHEN consecutive_failures + 1 >= $4::int THEN NOW()
+        ELSE NULL
+    END
+WHERE id = $5
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_owner, lease_expires_at, last_error, last_status, consecutive_failures, next_fetch_at, disabled_at
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type MarkFeedFetchFailedParams struct {
+	LastError      string
+	LastStatus     sql.NullInt32
+	BackoffSeconds int32
+	MaxFailures    int32
+	ID             uuid.UUID
+}
+
+func (q *Queries) MarkFeedFetchFailed(ctx context.Context, arg MarkFeedFetchFailedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFetchFailed,
+		arg.LastError,
+		arg.LastStatus,
+		arg.BackoffSeconds,
+		arg.MaxFailures,
+		arg.ID,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -127,19 +296,208 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :one
 UPDATE feeds 
-SET last_fetched_at = NOW(), updated_at = NOW()
+SET last_fetched_at = NOW(), updated_at = NOW(), lease_owner = NULL, lease_expires_at = NULL,
+    last_status = $2, last_error = NULL, consecutive_failures = 0, next_fetch_at = NULL
 WHERE feeds.ID = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_owner, lease_expires_at, last_error, last_status, consecutive_failures, next_fetch_at, disabled_at
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedFetched, id)
+type MarkFeedFetchedParams struct {
+	ID         uuid.UUID
+	LastStatus sql.NullInt32
+}
+
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFetched, arg.ID, arg.LastStatus)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const mergeFeedInto = `-- name: MergeFeedInto :exec
+WITH moved_follows AS (
+    UPDATE feed_follows
+    SET feed_id = $1, updated_at = NOW()
+    WHERE feed_id = $2
+        AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = $1)
+), moved_posts AS (
+    UPDATE posts
+    SET feed_id = $1, updated_at = NOW()
+    WHERE feed_id = $2
+        AND guid NOT IN (SELECT guid FROM posts WHERE feed_id = $1)
+), copied_reads AS (
+    INSERT INTO post_reads (user_id, post_id, read_at)
+    SELECT post_reads.user_id, new_posts.id, post_reads.read_at
+    FROM post_reads
+    INNER JOIN posts AS old_posts ON old_posts.id = post_reads.post_id
+    INNER JOIN posts AS new_posts ON new_posts.guid = old_posts.guid
+    WHERE old_posts.feed_id = $2 AND new_posts.feed_id = $1
+    ON CONFLICT DO NOTHING
+), relinked_saves AS (
+    UPDATE saved_posts
+    SET post_id = new_posts.id
+    FROM posts AS old_posts, posts AS new_posts
+    WHERE saved_posts.post_id = old_posts.id
+        AND old_posts.feed_id = $2
+        AND new_posts.feed_id = $1
+        AND new_posts.guid = old_posts.guid
+), moved_lease AS (
+    UPDATE feeds
+    SET lease_owner = old_feed.lease_owner, lease_expires_at = old_feed.lease_expires_at
+    FROM feeds AS old_feed
+    WHERE feeds.id = $1 AND old_feed.id = $2
+        AND (feeds.lease_expires_at IS NULL OR feeds.lease_expires_at < NOW())
+)
+DELETE FROM feeds WHERE feeds.id = $2
+`
+
+type MergeFeedIntoParams struct {
+	IntoID uuid.UUID
+	FromID uuid.UUID
+}
+
+// Moves the follows, posts, read marks and saved post links of one feed onto
+// another and deletes it. Follows and posts the target already has (by user
+// and by guid) are left behind and deleted with the old feed. The target takes
+// over the old feed's lease unless another aggregator holds one on it.
+func (q *Queries) MergeFeedInto(ctx context.Context, arg MergeFeedIntoParams) error {
+	_, err := q.db.ExecContext(ctx, mergeFeedInto, arg.IntoID, arg.FromID)
+	return err
+}
+
+const moveFeed = `-- name: MoveFeed :exec
+UPDATE feeds SET url = $2, updated_at = NOW() WHERE id = $1
+`
+
+type MoveFeedParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) MoveFeed(ctx context.Context, arg MoveFeedParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeed, arg.ID, arg.Url)
+	return err
+}
+
+const releaseFeedLease = `-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner = NULL, lease_expires_at = NULL
+WHERE id = $1 AND lease_owner = $2::text
+`
+
+type ReleaseFeedLeaseParams struct {
+	ID         uuid.UUID
+	LeaseOwner string
+}
+
+func (q *Queries) ReleaseFeedLease(ctx context.Context, arg ReleaseFeedLeaseParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedLease, arg.ID, arg.LeaseOwner)
+	return err
+}
+
+const renameFeed = `-- name: RenameFeed :one
+UPDATE feeds
+SET name = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_owner, lease_expires_at, last_error, last_status, consecutive_failures, next_fetch_at, disabled_at
+`
+
+type RenameFeedParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Name   string
+}
+
+func (q *Queries) RenameFeed(ctx context.Context, arg RenameFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, renameFeed, arg.ID, arg.UserID, arg.Name)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const updateFeedCacheHeaders = `-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedCacheHeadersParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) UpdateFeedCacheHeaders(ctx context.Context, arg UpdateFeedCacheHeadersParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheHeaders, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :one
+UPDATE feeds
+SET url = $3, updated_at = NOW(), etag = NULL, last_modified = NULL,
+    last_status = NULL, last_error = NULL, consecutive_failures = 0,
+    next_fetch_at = NULL, disabled_at = NULL
+WHERE id = $1 AND user_id = $2
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, lease_owner, lease_expires_at, last_error, last_status, consecutive_failures, next_fetch_at, disabled_at
+`
+
+type UpdateFeedURLParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Url    string
+}
+
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, updateFeedURL, arg.ID, arg.UserID, arg.Url)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -149,6 +507,15 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.DisabledAt,
 	)
 	return i, err
 }
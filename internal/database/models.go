@@ -11,14 +11,33 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     string
+	LastUsedAt sql.NullTime
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	LeaseOwner          sql.NullString
+	LeaseExpiresAt      sql.NullTime
+	LastError           sql.NullString
+	LastStatus          sql.NullInt32
+	ConsecutiveFailures int32
+	NextFetchAt         sql.NullTime
+	DisabledAt          sql.NullTime
 }
 
 type FeedFollow struct {
@@ -27,17 +46,41 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  sql.NullString
 }
 
 type Post struct {
+	ID                     uuid.UUID
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	Title                  string
+	Url                    string
+	Description            sql.NullString
+	PublishedAt            time.Time
+	FeedID                 uuid.UUID
+	PublishedAtSynthesized bool
+	Guid                   string
+	SearchVector           interface{}
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type SavedPost struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	PostID      uuid.NullUUID
 	Title       string
 	Url         string
 	Description sql.NullString
+	FeedName    string
 	PublishedAt time.Time
-	FeedID      uuid.UUID
+	Note        sql.NullString
 }
 
 type User struct {
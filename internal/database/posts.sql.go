@@ -13,88 +13,84 @@ import (
 	"github.com/google/uuid"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
-)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const adoptLegacyPostGUID = `-- name: AdoptLegacyPostGUID :execrows
+UPDATE posts
+SET guid = $1
+WHERE feed_id = $2
+    AND guid = $3
+    AND url = $3
+    AND NOT EXISTS (
+        SELECT 1 FROM posts taken
+        WHERE taken.feed_id = $2 AND taken.guid = $1
+    )
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+type AdoptLegacyPostGUIDParams struct {
+	Guid   string
+	FeedID uuid.UUID
+	Url    string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
-	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedID,
-	)
-	return i, err
+// Posts stored before posts had a guid were given their url as guid by
+// 010_posts_guid.sql. Re-keys such a post to the guid of the item it came
+// from, unless that guid is taken, so the upsert that follows updates it
+// instead of inserting a duplicate.
+func (q *Queries) AdoptLegacyPostGUID(ctx context.Context, arg AdoptLegacyPostGUIDParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, adoptLegacyPostGUID, arg.Guid, arg.FeedID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getPostForUser = `-- name: GetPostForUser :many
-SELECT 
-  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, 
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description,
+  posts.published_at, posts.feed_id, posts.published_at_synthesized, posts.guid,
   feeds.name AS feed_name
 FROM posts
 JOIN feeds ON posts.feed_id = feeds.id
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+  AND (NOT $2::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_reads
+    WHERE post_reads.post_id = posts.id AND post_reads.user_id = $1
+  ))
+  AND ($3::uuid IS NULL OR posts.feed_id = $3)
+ORDER BY posts.published_at DESC, posts.id
+LIMIT $4 OFFSET $5
 `
 
 type GetPostForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+	UserID     uuid.UUID
+	UnreadOnly bool
+	FeedID     uuid.NullUUID
+	Limit      int32
+	Offset     int32
 }
 
 type GetPostForUserRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt time.Time
-	FeedID      uuid.UUID
-	FeedName    string
+	ID                     uuid.UUID
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	Title                  string
+	Url                    string
+	Description            sql.NullString
+	PublishedAt            time.Time
+	FeedID                 uuid.UUID
+	PublishedAtSynthesized bool
+	Guid                   string
+	FeedName               string
 }
 
 func (q *Queries) GetPostForUser(ctx context.Context, arg GetPostForUserParams) ([]GetPostForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostForUser, arg.UserID, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, getPostForUser,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.FeedID,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +107,8 @@ func (q *Queries) GetPostForUser(ctx context.Context, arg GetPostForUserParams)
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.PublishedAtSynthesized,
+			&i.Guid,
 			&i.FeedName,
 		); err != nil {
 			return nil, err
@@ -125,3 +123,140 @@ func (q *Queries) GetPostForUser(ctx context.Context, arg GetPostForUserParams)
 	}
 	return items, nil
 }
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT
+  posts.id, posts.title, posts.url, posts.published_at, posts.published_at_synthesized,
+  feeds.name AS feed_name,
+  ts_rank(posts.search_vector, query)::real AS rank,
+  ts_headline('english', coalesce(posts.description, posts.title), query,
+    'StartSel=**, StopSel=**, MaxFragments=2, MaxWords=25, MinWords=10')::text AS snippet
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id,
+  websearch_to_tsquery('english', $1::text) AS query
+WHERE feed_follows.user_id = $2
+  AND posts.search_vector @@ query
+  AND ($3::text IS NULL OR feeds.url = $3::text)
+  AND ($4::timestamptz IS NULL OR posts.published_at >= $4::timestamptz)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $5
+`
+
+type SearchPostsForUserParams struct {
+	Query      string
+	UserID     uuid.UUID
+	FeedUrl    sql.NullString
+	Since      sql.NullTime
+	MaxResults int32
+}
+
+type SearchPostsForUserRow struct {
+	ID                     uuid.UUID
+	Title                  string
+	Url                    string
+	PublishedAt            time.Time
+	PublishedAtSynthesized bool
+	FeedName               string
+	Rank                   float32
+	Snippet                string
+}
+
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser,
+		arg.Query,
+		arg.UserID,
+		arg.FeedUrl,
+		arg.Since,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsForUserRow
+	for rows.Next() {
+		var i SearchPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.PublishedAtSynthesized,
+			&i.FeedName,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_synthesized, guid)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+    OR posts.url IS DISTINCT FROM EXCLUDED.url
+    OR posts.description IS DISTINCT FROM EXCLUDED.description
+RETURNING id, (xmax = 0)::boolean AS inserted
+`
+
+type UpsertPostParams struct {
+	ID                     uuid.UUID
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	Title                  string
+	Url                    string
+	Description            sql.NullString
+	PublishedAt            time.Time
+	FeedID                 uuid.UUID
+	PublishedAtSynthesized bool
+	Guid                   string
+}
+
+type UpsertPostRow struct {
+	ID       uuid.UUID
+	Inserted bool
+}
+
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (UpsertPostRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.PublishedAt,
+		arg.FeedID,
+		arg.PublishedAtSynthesized,
+		arg.Guid,
+	)
+	var i UpsertPostRow
+	err := row.Scan(&i.ID, &i.Inserted)
+	return i, err
+}
@@ -0,0 +1,349 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.Feed{}, foreignKeyViolation("feeds_user_id_fkey")
+	}
+	if _, ok := s.feeds[arg.ID]; ok {
+		return database.Feed{}, uniqueViolation("feeds_pkey")
+	}
+	if err := s.checkFeedUnique(arg.ID, arg.Name, arg.Url); err != nil {
+		return database.Feed{}, err
+	}
+	feed := database.Feed{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Name:      arg.Name,
+		Url:       arg.Url,
+		UserID:    arg.UserID,
+	}
+	s.feeds[feed.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) GetFeeds(ctx context.Context) ([]database.GetFeedsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.GetFeedsRow
+	for _, feed := range s.sortedFeeds() {
+		rows = append(rows, database.GetFeedsRow{
+			ID:                  feed.ID,
+			Name:                feed.Name,
+			Url:                 feed.Url,
+			Name_2:              s.users[feed.UserID].Name,
+			LastFetchedAt:       feed.LastFetchedAt,
+			LastStatus:          feed.LastStatus,
+			LastError:           feed.LastError,
+			ConsecutiveFailures: feed.ConsecutiveFailures,
+			NextFetchAt:         feed.NextFetchAt,
+			DisabledAt:          feed.DisabledAt,
+		})
+	}
+	return rows, nil
+}
+
+func (s *Store) GetFeedByURL(ctx context.Context, url string) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if feed, ok := s.feedByURL(url); ok {
+		return feed, nil
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
+func (s *Store) MarkFeedFetched(ctx context.Context, arg database.MarkFeedFetchedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	now := s.Now()
+	feed.LastFetchedAt = sql.NullTime{Time: now, Valid: true}
+	feed.UpdatedAt = now
+	feed.LeaseOwner = sql.NullString{}
+	feed.LeaseExpiresAt = sql.NullTime{}
+	feed.LastStatus = arg.LastStatus
+	feed.LastError = sql.NullString{}
+	feed.ConsecutiveFailures = 0
+	feed.NextFetchAt = sql.NullTime{}
+	s.feeds[feed.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) MarkFeedFetchFailed(ctx context.Context, arg database.MarkFeedFetchFailedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	now := s.Now()
+	feed.LastFetchedAt = sql.NullTime{Time: now, Valid: true}
+	feed.UpdatedAt = now
+	feed.LeaseOwner = sql.NullString{}
+	feed.LeaseExpiresAt = sql.NullTime{}
+	feed.LastError = sql.NullString{String: arg.LastError, Valid: true}
+	feed.LastStatus = arg.LastStatus
+	feed.ConsecutiveFailures++
+	feed.NextFetchAt = sql.NullTime{Time: now.Add(time.Duration(arg.BackoffSeconds) * time.Second), Valid: true}
+	feed.DisabledAt = sql.NullTime{}
+	if feed.ConsecutiveFailures >= arg.MaxFailures {
+		feed.DisabledAt = sql.NullTime{Time: now, Valid: true}
+	}
+	s.feeds[feed.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) ClaimFeedsToFetch(ctx context.Context, arg database.ClaimFeedsToFetchParams) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Now()
+	var due []database.Feed
+	for _, feed := range s.sortedFeeds() {
+		switch {
+		case feed.LeaseExpiresAt.Valid && !feed.LeaseExpiresAt.Time.Before(now):
+		case feed.DisabledAt.Valid:
+		case feed.NextFetchAt.Valid && feed.NextFetchAt.Time.After(now):
+		case feed.LastFetchedAt.Valid && !feed.LastFetchedAt.Time.Before(arg.DueBefore):
+		default:
+			due = append(due, feed)
+		}
+	}
+	// ORDER BY last_fetched_at ASC NULLS FIRST; the sort is stable, so ties
+	// keep their creation order.
+	slices.SortStableFunc(due, func(a, b database.Feed) int {
+		switch {
+		case !a.LastFetchedAt.Valid && !b.LastFetchedAt.Valid:
+			return 0
+		case !a.LastFetchedAt.Valid:
+			return -1
+		case !b.LastFetchedAt.Valid:
+			return 1
+		}
+		return a.LastFetchedAt.Time.Compare(b.LastFetchedAt.Time)
+	})
+	if len(due) > int(arg.BatchSize) {
+		due = due[:max(arg.BatchSize, 0)]
+	}
+	for i, feed := range due {
+		feed.LeaseOwner = sql.NullString{String: arg.LeaseOwner, Valid: true}
+		feed.LeaseExpiresAt = sql.NullTime{Time: now.Add(time.Duration(arg.LeaseSeconds) * time.Second), Valid: true}
+		feed.UpdatedAt = now
+		s.feeds[feed.ID] = feed
+		due[i] = feed
+	}
+	return due, nil
+}
+
+func (s *Store) ExtendFeedLease(ctx context.Context, arg database.ExtendFeedLeaseParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok || !feed.LeaseOwner.Valid || feed.LeaseOwner.String != arg.LeaseOwner {
+		return 0, nil
+	}
+	feed.LeaseExpiresAt = sql.NullTime{Time: s.Now().Add(time.Duration(arg.LeaseSeconds) * time.Second), Valid: true}
+	s.feeds[feed.ID] = feed
+	return 1, nil
+}
+
+func (s *Store) ReleaseFeedLease(ctx context.Context, arg database.ReleaseFeedLeaseParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok || !feed.LeaseOwner.Valid || feed.LeaseOwner.String != arg.LeaseOwner {
+		return nil
+	}
+	feed.LeaseOwner = sql.NullString{}
+	feed.LeaseExpiresAt = sql.NullTime{}
+	s.feeds[feed.ID] = feed
+	return nil
+}
+
+func (s *Store) UpdateFeedCacheHeaders(ctx context.Context, arg database.UpdateFeedCacheHeadersParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok {
+		return nil
+	}
+	feed.Etag = arg.Etag
+	feed.LastModified = arg.LastModified
+	feed.UpdatedAt = s.Now()
+	s.feeds[feed.ID] = feed
+	return nil
+}
+
+func (s *Store) RenameFeed(ctx context.Context, arg database.RenameFeedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok || feed.UserID != arg.UserID {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	if err := s.checkFeedUnique(feed.ID, arg.Name, feed.Url); err != nil {
+		return database.Feed{}, err
+	}
+	feed.Name = arg.Name
+	feed.UpdatedAt = s.Now()
+	s.feeds[feed.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) UpdateFeedURL(ctx context.Context, arg database.UpdateFeedURLParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok || feed.UserID != arg.UserID {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	if err := s.checkFeedUnique(feed.ID, feed.Name, arg.Url); err != nil {
+		return database.Feed{}, err
+	}
+	feed.Url = arg.Url
+	feed.UpdatedAt = s.Now()
+	feed.Etag = sql.NullString{}
+	feed.LastModified = sql.NullString{}
+	feed.LastStatus = sql.NullInt32{}
+	feed.LastError = sql.NullString{}
+	feed.ConsecutiveFailures = 0
+	feed.NextFetchAt = sql.NullTime{}
+	feed.DisabledAt = sql.NullTime{}
+	s.feeds[feed.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) MoveFeed(ctx context.Context, arg database.MoveFeedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok {
+		return nil
+	}
+	if err := s.checkFeedUnique(feed.ID, feed.Name, arg.Url); err != nil {
+		return err
+	}
+	feed.Url = arg.Url
+	feed.UpdatedAt = s.Now()
+	s.feeds[feed.ID] = feed
+	return nil
+}
+
+func (s *Store) DeleteFeed(ctx context.Context, arg database.DeleteFeedParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok || feed.UserID != arg.UserID {
+		return 0, nil
+	}
+	s.deleteFeed(feed.ID)
+	return 1, nil
+}
+
+func (s *Store) MergeFeedInto(ctx context.Context, arg database.MergeFeedIntoParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.feeds[arg.FromID]; !ok {
+		return nil
+	}
+	if _, ok := s.feeds[arg.IntoID]; !ok {
+		return foreignKeyViolation("foreign_key_feed")
+	}
+	now := s.Now()
+
+	for id, follow := range s.follows {
+		if follow.FeedID == arg.FromID && !s.isFollowing(follow.UserID, arg.IntoID) {
+			follow.FeedID = arg.IntoID
+			follow.UpdatedAt = now
+			s.follows[id] = follow
+		}
+	}
+
+	intoPosts := map[string]uuid.UUID{}
+	for _, post := range s.posts {
+		if post.FeedID == arg.IntoID {
+			intoPosts[post.Guid] = post.ID
+		}
+	}
+	for id, post := range s.posts {
+		if post.FeedID != arg.FromID {
+			continue
+		}
+		newID, duplicate := intoPosts[post.Guid]
+		if !duplicate {
+			post.FeedID = arg.IntoID
+			post.UpdatedAt = now
+			s.posts[id] = post
+			continue
+		}
+		for key, readAt := range s.reads {
+			if key.postID != id {
+				continue
+			}
+			if _, ok := s.reads[readKey{key.userID, newID}]; !ok {
+				s.reads[readKey{key.userID, newID}] = readAt
+			}
+		}
+		for savedID, saved := range s.saved {
+			if saved.PostID.Valid && saved.PostID.UUID == id {
+				saved.PostID = uuid.NullUUID{UUID: newID, Valid: true}
+				s.saved[savedID] = saved
+			}
+		}
+	}
+
+	from, into := s.feeds[arg.FromID], s.feeds[arg.IntoID]
+	if !into.LeaseExpiresAt.Valid || into.LeaseExpiresAt.Time.Before(now) {
+		into.LeaseOwner, into.LeaseExpiresAt = from.LeaseOwner, from.LeaseExpiresAt
+		s.feeds[arg.IntoID] = into
+	}
+
+	s.deleteFeed(arg.FromID)
+	return nil
+}
+
+func (s *Store) feedByURL(url string) (database.Feed, bool) {
+	for _, feed := range s.feeds {
+		if feed.Url == url {
+			return feed, true
+		}
+	}
+	return database.Feed{}, false
+}
+
+// checkFeedUnique enforces the unique name and url of feeds for the feed id
+// taking name and url.
+func (s *Store) checkFeedUnique(id uuid.UUID, name, url string) error {
+	for _, feed := range s.feeds {
+		if feed.ID == id {
+			continue
+		}
+		if feed.Name == name {
+			return uniqueViolation("feeds_name_key")
+		}
+		if feed.Url == url {
+			return uniqueViolation("feeds_url_key")
+		}
+	}
+	return nil
+}
+
+func (s *Store) sortedFeeds() []database.Feed {
+	return sortedValues(s.feeds,
+		func(f database.Feed) time.Time { return f.CreatedAt },
+		func(f database.Feed) uuid.UUID { return f.ID })
+}
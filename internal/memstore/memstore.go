@@ -0,0 +1,294 @@
+// Package memstore is an in-memory implementation of database.Querier for
+// tests. It keeps the rules of the Postgres schema in sql/schema that the
+// commands rely on: unique constraints, foreign keys and what deleting a row
+// cascades to.
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUniqueViolation     = errors.New("duplicate key value violates unique constraint")
+	ErrForeignKeyViolation = errors.New("insert or update violates foreign key constraint")
+)
+
+func uniqueViolation(constraint string) error {
+	return fmt.Errorf("%w %q", ErrUniqueViolation, constraint)
+}
+
+func foreignKeyViolation(constraint string) error {
+	return fmt.Errorf("%w %q", ErrForeignKeyViolation, constraint)
+}
+
+type readKey struct {
+	userID uuid.UUID
+	postID uuid.UUID
+}
+
+// Store is safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	users   map[uuid.UUID]database.User
+	feeds   map[uuid.UUID]database.Feed
+	follows map[uuid.UUID]database.FeedFollow
+	posts   map[uuid.UUID]database.Post
+	reads   map[readKey]time.Time
+	saved   map[uuid.UUID]database.SavedPost
+	tokens  map[uuid.UUID]database.ApiToken
+	// Now stands in for the database clock. It defaults to time.Now.
+	Now func() time.Time
+}
+
+var _ database.Querier = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		users:   map[uuid.UUID]database.User{},
+		feeds:   map[uuid.UUID]database.Feed{},
+		follows: map[uuid.UUID]database.FeedFollow{},
+		posts:   map[uuid.UUID]database.Post{},
+		reads:   map[readKey]time.Time{},
+		saved:   map[uuid.UUID]database.SavedPost{},
+		tokens:  map[uuid.UUID]database.ApiToken{},
+		Now:     time.Now,
+	}
+}
+
+// sortedValues returns the rows of m ordered by creation time, so results
+// are stable where the SQL leaves the order open.
+func sortedValues[T any](m map[uuid.UUID]T, createdAt func(T) time.Time, id func(T) uuid.UUID) []T {
+	rows := make([]T, 0, len(m))
+	for _, row := range m {
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b T) int {
+		if c := createdAt(a).Compare(createdAt(b)); c != 0 {
+			return c
+		}
+		return cmp.Compare(id(a).String(), id(b).String())
+	})
+	return rows
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[arg.ID]; ok {
+		return database.User{}, uniqueViolation("users_pkey")
+	}
+	for _, user := range s.users {
+		if user.Name == arg.Name {
+			return database.User{}, uniqueViolation("users_name_key")
+		}
+	}
+	user := database.User{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Name:      arg.Name,
+	}
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *Store) DeleteUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.users {
+		s.deleteUser(id)
+	}
+	return nil
+}
+
+func (s *Store) GetUser(ctx context.Context, name string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Name == name {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedValues(s.users,
+		func(u database.User) time.Time { return u.CreatedAt },
+		func(u database.User) uuid.UUID { return u.ID }), nil
+}
+
+func (s *Store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[arg.UserID]
+	if !ok {
+		return database.CreateFeedFollowRow{}, foreignKeyViolation("foreign_key_user")
+	}
+	feed, ok := s.feeds[arg.FeedID]
+	if !ok {
+		return database.CreateFeedFollowRow{}, foreignKeyViolation("foreign_key_feed")
+	}
+	if _, ok := s.follows[arg.ID]; ok {
+		return database.CreateFeedFollowRow{}, uniqueViolation("feed_follows_pkey")
+	}
+	if _, ok := s.findFollow(arg.UserID, arg.FeedID); ok {
+		return database.CreateFeedFollowRow{}, uniqueViolation("unique_ids")
+	}
+	follow := database.FeedFollow{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+		Category:  arg.Category,
+	}
+	s.follows[follow.ID] = follow
+	return database.CreateFeedFollowRow{
+		ID:        follow.ID,
+		CreatedAt: follow.CreatedAt,
+		UpdatedAt: follow.UpdatedAt,
+		UserID:    follow.UserID,
+		FeedID:    follow.FeedID,
+		Category:  follow.Category,
+		UserName:  user.Name,
+		FeedName:  feed.Name,
+	}, nil
+}
+
+func (s *Store) DeleteFollows(ctx context.Context, arg database.DeleteFollowsParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if follow, ok := s.findFollow(arg.UserID, arg.FeedID); ok {
+		delete(s.follows, follow.ID)
+	}
+	return nil
+}
+
+func (s *Store) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.GetFeedFollowsForUserRow
+	for _, follow := range s.sortedFollows() {
+		if follow.UserID != userID {
+			continue
+		}
+		feed := s.feeds[follow.FeedID]
+		var unread int64
+		for _, post := range s.posts {
+			if post.FeedID == follow.FeedID {
+				if _, read := s.reads[readKey{userID, post.ID}]; !read {
+					unread++
+				}
+			}
+		}
+		rows = append(rows, database.GetFeedFollowsForUserRow{
+			ID:          follow.ID,
+			CreatedAt:   follow.CreatedAt,
+			UpdatedAt:   follow.UpdatedAt,
+			UserID:      follow.UserID,
+			FeedID:      follow.FeedID,
+			Category:    follow.Category,
+			FeedName:    feed.Name,
+			FeedUrl:     feed.Url,
+			UserName:    s.users[userID].Name,
+			UnreadCount: unread,
+		})
+	}
+	return rows, nil
+}
+
+func (s *Store) findFollow(userID, feedID uuid.UUID) (database.FeedFollow, bool) {
+	for _, follow := range s.follows {
+		if follow.UserID == userID && follow.FeedID == feedID {
+			return follow, true
+		}
+	}
+	return database.FeedFollow{}, false
+}
+
+func (s *Store) sortedFollows() []database.FeedFollow {
+	return sortedValues(s.follows,
+		func(f database.FeedFollow) time.Time { return f.CreatedAt },
+		func(f database.FeedFollow) uuid.UUID { return f.ID })
+}
+
+func (s *Store) isFollowing(userID, feedID uuid.UUID) bool {
+	_, ok := s.findFollow(userID, feedID)
+	return ok
+}
+
+// deleteUser removes a user and everything that references it with ON
+// DELETE CASCADE.
+func (s *Store) deleteUser(id uuid.UUID) {
+	delete(s.users, id)
+	for feedID, feed := range s.feeds {
+		if feed.UserID == id {
+			s.deleteFeed(feedID)
+		}
+	}
+	for followID, follow := range s.follows {
+		if follow.UserID == id {
+			delete(s.follows, followID)
+		}
+	}
+	for key := range s.reads {
+		if key.userID == id {
+			delete(s.reads, key)
+		}
+	}
+	for savedID, saved := range s.saved {
+		if saved.UserID == id {
+			delete(s.saved, savedID)
+		}
+	}
+	for tokenID, token := range s.tokens {
+		if token.UserID == id {
+			delete(s.tokens, tokenID)
+		}
+	}
+}
+
+// deleteFeed removes a feed with its follows and posts.
+func (s *Store) deleteFeed(id uuid.UUID) {
+	delete(s.feeds, id)
+	for followID, follow := range s.follows {
+		if follow.FeedID == id {
+			delete(s.follows, followID)
+		}
+	}
+	for postID, post := range s.posts {
+		if post.FeedID == id {
+			s.deletePost(postID)
+		}
+	}
+}
+
+// deletePost removes a post and its read marks. Saved copies of it are kept
+// but lose their link to it (ON DELETE SET NULL).
+func (s *Store) deletePost(id uuid.UUID) {
+	delete(s.posts, id)
+	for key := range s.reads {
+		if key.postID == id {
+			delete(s.reads, key)
+		}
+	}
+	for savedID, saved := range s.saved {
+		if saved.PostID.Valid && saved.PostID.UUID == id {
+			saved.PostID = uuid.NullUUID{}
+			s.saved[savedID] = saved
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestConstraints(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Now()
+
+	user, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "kam"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	_, err = s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "kam"})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("expected a unique violation for a duplicate name but got: %v", err)
+	}
+
+	feed, err := s.CreateFeed(ctx, database.CreateFeedParams{
+		ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "blog", Url: "https://example.com/feed", UserID: user.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to create feed: %v", err)
+	}
+	_, err = s.CreateFeed(ctx, database.CreateFeedParams{
+		ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "other", Url: feed.Url, UserID: user.ID,
+	})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("expected a unique violation for a duplicate url but got: %v", err)
+	}
+	_, err = s.CreateFeed(ctx, database.CreateFeedParams{
+		ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "orphan", Url: "https://example.com/orphan", UserID: uuid.New(),
+	})
+	if !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("expected a foreign key violation for an unknown user but got: %v", err)
+	}
+
+	post := database.UpsertPostParams{
+		ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Title: "Hello", Url: "https://example.com/hello",
+		PublishedAt: now, FeedID: feed.ID, Guid: "hello",
+	}
+	if row, err := s.UpsertPost(ctx, post); err != nil || !row.Inserted {
+		t.Fatalf("expected the post to be inserted but got %+v, %v", row, err)
+	}
+	if _, err := s.UpsertPost(ctx, post); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected an unchanged post to be skipped but got: %v", err)
+	}
+	postID := post.ID
+	post.ID, post.Title = uuid.New(), "Hello again"
+	if row, err := s.UpsertPost(ctx, post); err != nil || row.Inserted {
+		t.Errorf("expected the post to be updated in place but got %+v, %v", row, err)
+	}
+	saved, err := s.SavePost(ctx, database.SavePostParams{
+		ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID, PostID: postID,
+	})
+	if err != nil {
+		t.Fatalf("failed to save post: %v", err)
+	}
+
+	if _, err := s.DeleteFeed(ctx, database.DeleteFeedParams{ID: feed.ID, UserID: user.ID}); err != nil {
+		t.Fatalf("failed to delete feed: %v", err)
+	}
+	if len(s.posts) != 0 {
+		t.Errorf("expected deleting the feed to delete its posts but %d are left", len(s.posts))
+	}
+	if got := s.saved[saved.ID]; got.PostID.Valid || got.Title != "Hello again" {
+		t.Errorf("expected the saved copy to be kept and unlinked but got %+v", got)
+	}
+
+	if err := s.DeleteUsers(ctx); err != nil {
+		t.Fatalf("failed to delete users: %v", err)
+	}
+	if len(s.saved) != 0 {
+		t.Errorf("expected deleting the user to delete their saved posts but %d are left", len(s.saved))
+	}
+}
+
+func TestClaimFeedsToFetch(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	user, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "kam"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	const feeds = 20
+	for i := range feeds {
+		_, err := s.CreateFeed(ctx, database.CreateFeedParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: fmt.Sprintf("blog %d", i),
+			Url: fmt.Sprintf("https://example.com/%d/feed", i), UserID: user.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to create feed: %v", err)
+		}
+	}
+
+	t.Run("concurrent claimers", func(t *testing.T) {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			claimed = map[uuid.UUID]string{}
+		)
+		for w := range 8 {
+			wg.Add(1)
+			go func(owner string) {
+				defer wg.Done()
+				for {
+					batch, err := s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+						LeaseOwner: owner, LeaseSeconds: 60, DueBefore: now, BatchSize: 3,
+					})
+					if err != nil {
+						t.Errorf("failed to claim feeds: %v", err)
+						return
+					}
+					if len(batch) == 0 {
+						return
+					}
+					mu.Lock()
+					for _, feed := range batch {
+						if other, ok := claimed[feed.ID]; ok {
+							t.Errorf("feed %s was claimed by both %s and %s", feed.Name, other, owner)
+						}
+						claimed[feed.ID] = owner
+					}
+					mu.Unlock()
+				}
+			}(fmt.Sprintf("worker-%d", w))
+		}
+		wg.Wait()
+		if len(claimed) != feeds {
+			t.Errorf("expected all %d feeds to be claimed but got %d", feeds, len(claimed))
+		}
+	})
+
+	t.Run("expired lease", func(t *testing.T) {
+		now = now.Add(59 * time.Second)
+		again, err := s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: "late", LeaseSeconds: 60, DueBefore: now, BatchSize: feeds,
+		})
+		if err != nil || len(again) != 0 {
+			t.Errorf("expected leased feeds not to be claimed again but got %d, %v", len(again), err)
+		}
+		now = now.Add(2 * time.Second)
+		again, err = s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: "late", LeaseSeconds: 60, DueBefore: now, BatchSize: feeds,
+		})
+		if err != nil || len(again) != feeds {
+			t.Fatalf("expected every expired lease to be claimed again but got %d, %v", len(again), err)
+		}
+		n, err := s.ExtendFeedLease(ctx, database.ExtendFeedLeaseParams{LeaseSeconds: 60, ID: again[0].ID, LeaseOwner: "worker-0"})
+		if err != nil || n != 0 {
+			t.Errorf("expected the previous owner not to extend a lost lease but got %d, %v", n, err)
+		}
+	})
+}
@@ -0,0 +1,477 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) AdoptLegacyPostGUID(ctx context.Context, arg database.AdoptLegacyPostGUIDParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var legacy *database.Post
+	for _, post := range s.posts {
+		if post.FeedID != arg.FeedID {
+			continue
+		}
+		if post.Guid == arg.Guid {
+			return 0, nil
+		}
+		if post.Guid == arg.Url && post.Url == arg.Url {
+			legacy = &post
+		}
+	}
+	if legacy == nil {
+		return 0, nil
+	}
+	legacy.Guid = arg.Guid
+	s.posts[legacy.ID] = *legacy
+	return 1, nil
+}
+
+func (s *Store) UpsertPost(ctx context.Context, arg database.UpsertPostParams) (database.UpsertPostRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.feeds[arg.FeedID]; !ok {
+		return database.UpsertPostRow{}, foreignKeyViolation("posts_feed_id_fkey")
+	}
+	for id, post := range s.posts {
+		if post.FeedID != arg.FeedID || post.Guid != arg.Guid {
+			continue
+		}
+		if post.Title == arg.Title && post.Url == arg.Url && post.Description == arg.Description {
+			// ON CONFLICT DO UPDATE ... WHERE matched nothing.
+			return database.UpsertPostRow{}, sql.ErrNoRows
+		}
+		post.Title = arg.Title
+		post.Url = arg.Url
+		post.Description = arg.Description
+		post.UpdatedAt = arg.UpdatedAt
+		s.posts[id] = post
+		return database.UpsertPostRow{ID: id, Inserted: false}, nil
+	}
+	if _, ok := s.posts[arg.ID]; ok {
+		return database.UpsertPostRow{}, uniqueViolation("posts_pkey")
+	}
+	s.posts[arg.ID] = database.Post{
+		ID:                     arg.ID,
+		CreatedAt:              arg.CreatedAt,
+		UpdatedAt:              arg.UpdatedAt,
+		Title:                  arg.Title,
+		Url:                    arg.Url,
+		Description:            arg.Description,
+		PublishedAt:            arg.PublishedAt,
+		FeedID:                 arg.FeedID,
+		PublishedAtSynthesized: arg.PublishedAtSynthesized,
+		Guid:                   arg.Guid,
+	}
+	return database.UpsertPostRow{ID: arg.ID, Inserted: true}, nil
+}
+
+func (s *Store) GetPostForUser(ctx context.Context, arg database.GetPostForUserParams) ([]database.GetPostForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.GetPostForUserRow
+	for _, post := range s.postsForUser(arg.UserID) {
+		if _, read := s.reads[readKey{arg.UserID, post.ID}]; read && arg.UnreadOnly {
+			continue
+		}
+		if arg.FeedID.Valid && post.FeedID != arg.FeedID.UUID {
+			continue
+		}
+		rows = append(rows, database.GetPostForUserRow{
+			ID:                     post.ID,
+			CreatedAt:              post.CreatedAt,
+			UpdatedAt:              post.UpdatedAt,
+			Title:                  post.Title,
+			Url:                    post.Url,
+			Description:            post.Description,
+			PublishedAt:            post.PublishedAt,
+			FeedID:                 post.FeedID,
+			PublishedAtSynthesized: post.PublishedAtSynthesized,
+			Guid:                   post.Guid,
+			FeedName:               s.feeds[post.FeedID].Name,
+		})
+	}
+	rows = rows[min(int(max(arg.Offset, 0)), len(rows)):]
+	if len(rows) > int(arg.Limit) {
+		rows = rows[:max(arg.Limit, 0)]
+	}
+	return rows, nil
+}
+
+// SearchPostsForUser approximates the Postgres full-text search: terms match
+// words they are a prefix of, standing in for stemming, and rank counts
+// matches, with title matches weighing more like the 'A' weight they get in
+// posts.search_vector.
+func (s *Store) SearchPostsForUser(ctx context.Context, arg database.SearchPostsForUserParams) ([]database.SearchPostsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := parseWebSearch(arg.Query)
+	var rows []database.SearchPostsForUserRow
+	for _, post := range s.postsForUser(arg.UserID) {
+		feed := s.feeds[post.FeedID]
+		if arg.FeedUrl.Valid && feed.Url != arg.FeedUrl.String {
+			continue
+		}
+		if arg.Since.Valid && post.PublishedAt.Before(arg.Since.Time) {
+			continue
+		}
+		title, description := words(post.Title), words(post.Description.String)
+		if !query.matches(append(slices.Clone(title), description...)) {
+			continue
+		}
+		snippetSource := post.Description.String
+		if !post.Description.Valid {
+			snippetSource = post.Title
+		}
+		rows = append(rows, database.SearchPostsForUserRow{
+			ID:                     post.ID,
+			Title:                  post.Title,
+			Url:                    post.Url,
+			PublishedAt:            post.PublishedAt,
+			PublishedAtSynthesized: post.PublishedAtSynthesized,
+			FeedName:               feed.Name,
+			Rank:                   float32(query.count(title))*1.0 + float32(query.count(description))*0.4,
+			Snippet:                query.highlight(snippetSource),
+		})
+	}
+	slices.SortStableFunc(rows, func(a, b database.SearchPostsForUserRow) int {
+		if a.Rank != b.Rank {
+			if a.Rank > b.Rank {
+				return -1
+			}
+			return 1
+		}
+		return b.PublishedAt.Compare(a.PublishedAt)
+	})
+	if len(rows) > int(arg.MaxResults) {
+		rows = rows[:max(arg.MaxResults, 0)]
+	}
+	return rows, nil
+}
+
+func (s *Store) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[arg.UserID]; !ok {
+		return foreignKeyViolation("post_reads_user_id_fkey")
+	}
+	if _, ok := s.posts[arg.PostID]; !ok {
+		return foreignKeyViolation("post_reads_post_id_fkey")
+	}
+	s.markRead(arg.UserID, arg.PostID)
+	return nil
+}
+
+func (s *Store) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reads, readKey{arg.UserID, arg.PostID})
+	return nil
+}
+
+func (s *Store) MarkFeedRead(ctx context.Context, arg database.MarkFeedReadParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var marked int64
+	for _, post := range s.posts {
+		if post.FeedID == arg.FeedID && s.markRead(arg.UserID, post.ID) {
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (s *Store) MarkFeedUnread(ctx context.Context, arg database.MarkFeedUnreadParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var unmarked int64
+	for key := range s.reads {
+		if key.userID == arg.UserID && s.posts[key.postID].FeedID == arg.FeedID {
+			delete(s.reads, key)
+			unmarked++
+		}
+	}
+	return unmarked, nil
+}
+
+func (s *Store) MarkPostsReadBefore(ctx context.Context, arg database.MarkPostsReadBeforeParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var marked int64
+	for _, post := range s.postsForUser(arg.UserID) {
+		if post.PublishedAt.Before(arg.Before) && s.markRead(arg.UserID, post.ID) {
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (s *Store) SavePost(ctx context.Context, arg database.SavePostParams) (database.SavedPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, ok := s.posts[arg.PostID]
+	if !ok {
+		return database.SavedPost{}, sql.ErrNoRows
+	}
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.SavedPost{}, foreignKeyViolation("saved_posts_user_id_fkey")
+	}
+	for id, saved := range s.saved {
+		if saved.UserID == arg.UserID && saved.Url == post.Url {
+			if arg.Note.Valid {
+				saved.Note = arg.Note
+			}
+			saved.UpdatedAt = arg.UpdatedAt
+			s.saved[id] = saved
+			return saved, nil
+		}
+	}
+	if _, ok := s.saved[arg.ID]; ok {
+		return database.SavedPost{}, uniqueViolation("saved_posts_pkey")
+	}
+	saved := database.SavedPost{
+		ID:          arg.ID,
+		CreatedAt:   arg.CreatedAt,
+		UpdatedAt:   arg.UpdatedAt,
+		UserID:      arg.UserID,
+		PostID:      uuid.NullUUID{UUID: post.ID, Valid: true},
+		Title:       post.Title,
+		Url:         post.Url,
+		Description: post.Description,
+		FeedName:    s.feeds[post.FeedID].Name,
+		PublishedAt: post.PublishedAt,
+		Note:        arg.Note,
+	}
+	s.saved[saved.ID] = saved
+	return saved, nil
+}
+
+func (s *Store) DeleteSavedPost(ctx context.Context, arg database.DeleteSavedPostParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for id, saved := range s.saved {
+		if saved.UserID != arg.UserID {
+			continue
+		}
+		if saved.Url == arg.Ref || (saved.PostID.Valid && saved.PostID.UUID.String() == arg.Ref) {
+			delete(s.saved, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) GetSavedPostsForUser(ctx context.Context, arg database.GetSavedPostsForUserParams) ([]database.SavedPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	search := strings.ToLower(unescapeLike(arg.Search.String))
+	contains := func(field sql.NullString) bool {
+		return field.Valid && strings.Contains(strings.ToLower(field.String), search)
+	}
+	var rows []database.SavedPost
+	for _, saved := range s.saved {
+		if saved.UserID != arg.UserID {
+			continue
+		}
+		if arg.Search.Valid && !strings.Contains(strings.ToLower(saved.Title), search) &&
+			!contains(saved.Description) && !contains(saved.Note) {
+			continue
+		}
+		rows = append(rows, saved)
+	}
+	slices.SortFunc(rows, func(a, b database.SavedPost) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return rows, nil
+}
+
+// unescapeLike undoes the backslash escaping of a LIKE pattern matched
+// literally.
+func unescapeLike(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// postsForUser returns the posts of the feeds userID follows, newest first.
+func (s *Store) postsForUser(userID uuid.UUID) []database.Post {
+	var posts []database.Post
+	for _, post := range s.posts {
+		if s.isFollowing(userID, post.FeedID) {
+			posts = append(posts, post)
+		}
+	}
+	slices.SortFunc(posts, func(a, b database.Post) int {
+		if c := b.PublishedAt.Compare(a.PublishedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return posts
+}
+
+// markRead reports whether the post was not marked read yet.
+func (s *Store) markRead(userID, postID uuid.UUID) bool {
+	key := readKey{userID, postID}
+	if _, ok := s.reads[key]; ok {
+		return false
+	}
+	s.reads[key] = s.Now()
+	return true
+}
+
+// webSearch is a parsed websearch_to_tsquery query: alternatives separated by
+// "or", each made of terms that must all match. A term is one word or a
+// quoted phrase, and may be negated with a leading "-".
+type webSearch [][]searchTerm
+
+type searchTerm struct {
+	words  []string
+	negate bool
+}
+
+func parseWebSearch(query string) webSearch {
+	var search webSearch
+	var group []searchTerm
+	negate := false
+	for len(query) > 0 {
+		r := rune(query[0])
+		switch {
+		case r == '-':
+			negate = true
+			query = query[1:]
+			continue
+		case r == '"':
+			phrase, rest, _ := strings.Cut(query[1:], `"`)
+			if w := words(phrase); len(w) > 0 {
+				group = append(group, searchTerm{words: w, negate: negate})
+			}
+			query, negate = rest, false
+			continue
+		case unicode.IsSpace(r):
+			query, negate = query[1:], false
+			continue
+		}
+		end := strings.IndexFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if end < 0 {
+			end = len(query)
+		}
+		token := query[:end]
+		query = query[end:]
+		if strings.EqualFold(token, "or") && !negate {
+			if len(group) > 0 {
+				search = append(search, group)
+			}
+			group = nil
+			continue
+		}
+		if w := words(token); len(w) > 0 {
+			for _, word := range w {
+				group = append(group, searchTerm{words: []string{word}, negate: negate})
+			}
+		}
+		negate = false
+	}
+	if len(group) > 0 {
+		search = append(search, group)
+	}
+	return search
+}
+
+func (q webSearch) matches(text []string) bool {
+	for _, group := range q {
+		ok := true
+		for _, term := range group {
+			if (term.occurrences(text) > 0) == term.negate {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// count returns how often the query's positive terms occur in text.
+func (q webSearch) count(text []string) int {
+	n := 0
+	for _, group := range q {
+		for _, term := range group {
+			if !term.negate {
+				n += term.occurrences(text)
+			}
+		}
+	}
+	return n
+}
+
+func (t searchTerm) occurrences(text []string) int {
+	n := 0
+	for i := 0; i+len(t.words) <= len(text); i++ {
+		match := true
+		for j, word := range t.words {
+			if !strings.HasPrefix(text[i+j], word) {
+				match = false
+				break
+			}
+		}
+		if match {
+			n++
+		}
+	}
+	return n
+}
+
+// highlight wraps the words of text that match a positive term in "**",
+// like ts_headline with StartSel=** and StopSel=**.
+func (q webSearch) highlight(text string) string {
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		w := words(field)
+		if len(w) == 0 {
+			continue
+		}
+		if q.highlights(w[0]) {
+			fields[i] = "**" + field + "**"
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func (q webSearch) highlights(word string) bool {
+	for _, group := range q {
+		for _, term := range group {
+			for _, w := range term.words {
+				if !term.negate && strings.HasPrefix(word, w) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// words splits text into lowercase words.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
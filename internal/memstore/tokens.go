@@ -0,0 +1,95 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateAPIToken(ctx context.Context, arg database.CreateAPITokenParams) (database.ApiToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.ApiToken{}, foreignKeyViolation("api_tokens_user_id_fkey")
+	}
+	if _, ok := s.tokens[arg.ID]; ok {
+		return database.ApiToken{}, uniqueViolation("api_tokens_pkey")
+	}
+	for _, token := range s.tokens {
+		if token.TokenHash == arg.TokenHash {
+			return database.ApiToken{}, uniqueViolation("api_tokens_token_hash_key")
+		}
+		if token.UserID == arg.UserID && token.Name == arg.Name {
+			return database.ApiToken{}, uniqueViolation("api_tokens_user_name_key")
+		}
+	}
+	token := database.ApiToken{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+	}
+	s.tokens[token.ID] = token
+	return token, nil
+}
+
+func (s *Store) DeleteAPIToken(ctx context.Context, arg database.DeleteAPITokenParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for id, token := range s.tokens {
+		if token.UserID == arg.UserID && (token.Name == arg.Ref || id.String() == arg.Ref) {
+			delete(s.tokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) GetAPITokensForUser(ctx context.Context, userID uuid.UUID) ([]database.ApiToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.ApiToken
+	for _, token := range sortedValues(s.tokens,
+		func(t database.ApiToken) time.Time { return t.CreatedAt },
+		func(t database.ApiToken) uuid.UUID { return t.ID }) {
+		if token.UserID == userID {
+			rows = append(rows, token)
+		}
+	}
+	return rows, nil
+}
+
+func (s *Store) GetUserByAPIToken(ctx context.Context, tokenHash string) (database.GetUserByAPITokenRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.TokenHash == tokenHash {
+			user := s.users[token.UserID]
+			return database.GetUserByAPITokenRow{
+				ID:        user.ID,
+				CreatedAt: user.CreatedAt,
+				UpdatedAt: user.UpdatedAt,
+				Name:      user.Name,
+				TokenID:   token.ID,
+				Scopes:    token.Scopes,
+			}, nil
+		}
+	}
+	return database.GetUserByAPITokenRow{}, sql.ErrNoRows
+}
+
+func (s *Store) MarkAPITokenUsed(ctx context.Context, arg database.MarkAPITokenUsedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token, ok := s.tokens[arg.ID]; ok {
+		token.LastUsedAt = sql.NullTime{Time: arg.LastUsedAt, Valid: true}
+		s.tokens[arg.ID] = token
+	}
+	return nil
+}
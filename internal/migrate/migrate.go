@@ -0,0 +1,309 @@
+// Package migrate applies the goose migrations in sql/schema (or
+// sql/sqlite/schema) from an embedded file system. It keeps its bookkeeping
+// in goose's goose_db_version table, so databases migrated with the goose
+// CLI and with gator stay interchangeable.
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const versionTable = "goose_db_version"
+
+// Dialect is the kind of database a Migrator works on.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+// tableExists is a query that reports whether the table named by its
+// argument exists.
+func (d Dialect) tableExists() string {
+	if d == SQLite {
+		return "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1)"
+	}
+	return "SELECT to_regclass($1) IS NOT NULL"
+}
+
+// createVersionTable creates goose_db_version with the columns goose uses
+// for the dialect.
+func (d Dialect) createVersionTable() string {
+	if d == SQLite {
+		return `CREATE TABLE IF NOT EXISTS ` + versionTable + ` (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version_id INTEGER NOT NULL,
+    is_applied INTEGER NOT NULL,
+    tstamp TIMESTAMP DEFAULT (datetime('now'))
+)`
+	}
+	return `CREATE TABLE IF NOT EXISTS ` + versionTable + ` (
+    id serial PRIMARY KEY,
+    version_id bigint NOT NULL,
+    is_applied boolean NOT NULL,
+    tstamp timestamp NULL DEFAULT now()
+)`
+}
+
+// Migration is one numbered migration file.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// NoTransaction is set by "-- +goose NO TRANSACTION", for statements
+	// such as CREATE INDEX CONCURRENTLY that cannot run in a transaction.
+	NoTransaction bool
+}
+
+// Status is a migration, whether it has been applied and when, if goose
+// recorded the time.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt sql.NullTime
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New reads the *.sql migrations at the root of fsys, which are written for
+// dialect.
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	m := &Migrator{db: db, dialect: dialect}
+	seen := map[int64]string{}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+		migration, err := parse(name, string(data))
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[migration.Version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, name)
+		}
+		seen[migration.Version] = name
+		m.migrations = append(m.migrations, migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return m, nil
+}
+
+func parse(name, content string) (Migration, error) {
+	prefix, _, ok := strings.Cut(path.Base(name), "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if !ok || err != nil || version < 1 {
+		return Migration{}, fmt.Errorf("migration %s does not start with a version number", name)
+	}
+	migration := Migration{Version: version, Name: name}
+
+	var up, down strings.Builder
+	var section *strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		annotation, isAnnotation := strings.CutPrefix(strings.TrimSpace(line), "-- +goose ")
+		if isAnnotation {
+			switch strings.TrimSpace(annotation) {
+			case "Up":
+				section = &up
+				continue
+			case "Down":
+				section = &down
+				continue
+			case "NO TRANSACTION":
+				migration.NoTransaction = true
+				continue
+			}
+			// StatementBegin/End only matter to goose's statement splitter;
+			// each section is sent to the server as a whole.
+		}
+		if section != nil {
+			section.WriteString(line)
+			section.WriteString("\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Migration{}, fmt.Errorf("failed to read migration %s: %w", name, err)
+	}
+	if strings.TrimSpace(up.String()) == "" {
+		return Migration{}, fmt.Errorf("migration %s has no -- +goose Up section", name)
+	}
+	migration.Up = up.String()
+	migration.Down = down.String()
+	return migration, nil
+}
+
+// Latest is the version of the newest migration, which the code built
+// alongside it expects the database to be at.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the version the database is at, 0 if it has never been
+// migrated.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var exists bool
+	err := m.db.QueryRowContext(ctx, m.dialect.tableExists(), versionTable).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look for %s: %w", versionTable, err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int64
+	err = m.db.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version_id), 0) FROM "+versionTable+" WHERE is_applied").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones it applied. It stops at the first failure.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+	current, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		err := m.apply(ctx, migration, migration.Up,
+			"INSERT INTO "+versionTable+" (version_id, is_applied) VALUES ($1, true)")
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the most recently applied migration and returns it. It
+// returns false when there is nothing to roll back.
+func (m *Migrator) Down(ctx context.Context) (Migration, bool, error) {
+	current, err := m.Version(ctx)
+	if err != nil || current == 0 {
+		return Migration{}, false, err
+	}
+	for _, migration := range m.migrations {
+		if migration.Version != current {
+			continue
+		}
+		err := m.apply(ctx, migration, migration.Down,
+			"DELETE FROM "+versionTable+" WHERE version_id = $1")
+		return migration, err == nil, err
+	}
+	return Migration{}, false, fmt.Errorf("the database is at version %d, which has no migration file", current)
+}
+
+// Status lists every migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[int64]sql.NullTime{}
+	if current > 0 {
+		// Later rows win, so a migration that was rolled back and applied
+		// again shows when it was last applied.
+		rows, err := m.db.QueryContext(ctx,
+			"SELECT version_id, tstamp FROM "+versionTable+" WHERE is_applied ORDER BY id")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int64
+			var at sql.NullTime
+			if err := rows.Scan(&version, &at); err != nil {
+				return nil, err
+			}
+			appliedAt[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		at, ok := appliedAt[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// ensureVersionTable creates goose_db_version the way goose does, including
+// its initial version 0 row.
+func (m *Migrator) ensureVersionTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, m.dialect.createVersionTable())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", versionTable, err)
+	}
+	_, err = m.db.ExecContext(ctx, `INSERT INTO `+versionTable+` (version_id, is_applied)
+SELECT 0, true WHERE NOT EXISTS (SELECT 1 FROM `+versionTable+`)`)
+	if err != nil {
+		return fmt.Errorf("failed to initialise %s: %w", versionTable, err)
+	}
+	return nil
+}
+
+// apply runs statements and then record, with the migration's version as its
+// argument, in one transaction unless the migration opts out.
+func (m *Migrator) apply(ctx context.Context, migration Migration, statements, record string) error {
+	if strings.TrimSpace(statements) == "" {
+		// Nothing to run, e.g. a migration without a Down section.
+		statements = "SELECT 1"
+	}
+	if migration.NoTransaction {
+		if _, err := m.db.ExecContext(ctx, statements); err != nil {
+			return fmt.Errorf("migration %s failed: %w", migration.Name, err)
+		}
+		if _, err := m.db.ExecContext(ctx, record, migration.Version); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+		}
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		return fmt.Errorf("migration %s failed: %w", migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNew(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_feeds.sql": {Data: []byte(`-- +goose Up
+CREATE TABLE feeds (id UUID PRIMARY KEY);
+
+-- +goose Down
+DROP TABLE feeds;
+`)},
+		"001_users.sql": {Data: []byte(`-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE users (id UUID PRIMARY KEY);
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE users;
+`)},
+		"010_index.sql": {Data: []byte(`-- +goose NO TRANSACTION
+-- +goose Up
+CREATE INDEX CONCURRENTLY feeds_idx ON feeds (id);
+`)},
+		"README.md": {Data: []byte("not a migration")},
+	}
+
+	m, err := New(nil, Postgres, fsys)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if len(m.migrations) != 3 {
+		t.Fatalf("expected 3 migrations but got %d", len(m.migrations))
+	}
+	if m.Latest() != 10 {
+		t.Errorf("expected latest version 10 but got %d", m.Latest())
+	}
+
+	users := m.migrations[0]
+	if users.Version != 1 || users.Name != "001_users.sql" {
+		t.Errorf("expected 001_users.sql first but got %s (version %d)", users.Name, users.Version)
+	}
+	if !strings.Contains(users.Up, "CREATE TABLE users") || strings.Contains(users.Up, "DROP TABLE") {
+		t.Errorf("unexpected Up section: %q", users.Up)
+	}
+	if strings.TrimSpace(users.Down) != "DROP TABLE users;" {
+		t.Errorf("unexpected Down section: %q", users.Down)
+	}
+	if users.NoTransaction {
+		t.Errorf("expected 001_users.sql to run in a transaction")
+	}
+
+	index := m.migrations[2]
+	if !index.NoTransaction {
+		t.Errorf("expected 010_index.sql to run without a transaction")
+	}
+	if index.Down != "" {
+		t.Errorf("expected no Down section but got %q", index.Down)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"no version": {"users.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")}},
+		"no up":      {"001_users.sql": {Data: []byte("CREATE TABLE users (id UUID);\n")}},
+		"duplicate": {
+			"001_users.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+			"01_feeds.sql":  {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(nil, Postgres, fsys); err == nil {
+				t.Errorf("expected an error, got nil")
+			}
+		})
+	}
+}
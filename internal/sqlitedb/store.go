@@ -0,0 +1,374 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store runs the commands' queries against SQLite. It implements
+// database.Querier on top of the queries generated from sql/sqlite/queries,
+// converting between the two packages' types and making up for what SQLite
+// lacks: timestamps are stored as text, so every time is passed in UTC to
+// keep them comparable, and search queries are translated from web search
+// syntax to FTS4.
+type Store struct {
+	db *sql.DB
+	q  *Queries
+}
+
+var _ database.Querier = (*Store)(nil)
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db, q: New(utcDB{db})}
+}
+
+// utcDB passes every time argument on in UTC.
+type utcDB struct {
+	DBTX
+}
+
+func (db utcDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DBTX.ExecContext(ctx, query, inUTC(args)...)
+}
+
+func (db utcDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DBTX.QueryContext(ctx, query, inUTC(args)...)
+}
+
+func (db utcDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DBTX.QueryRowContext(ctx, query, inUTC(args)...)
+}
+
+func inUTC(args []interface{}) []interface{} {
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = v.UTC()
+		case sql.NullTime:
+			args[i] = sql.NullTime{Time: v.Time.UTC(), Valid: v.Valid}
+		}
+	}
+	return args
+}
+
+func (s *Store) AdoptLegacyPostGUID(ctx context.Context, arg database.AdoptLegacyPostGUIDParams) (int64, error) {
+	return s.q.AdoptLegacyPostGUID(ctx, AdoptLegacyPostGUIDParams(arg))
+}
+
+func (s *Store) ClaimFeedsToFetch(ctx context.Context, arg database.ClaimFeedsToFetchParams) ([]database.Feed, error) {
+	feeds, err := s.q.ClaimFeedsToFetch(ctx, ClaimFeedsToFetchParams(arg))
+	return convertFeeds(feeds), err
+}
+
+func (s *Store) CreateAPIToken(ctx context.Context, arg database.CreateAPITokenParams) (database.ApiToken, error) {
+	token, err := s.q.CreateAPIToken(ctx, CreateAPITokenParams(arg))
+	return database.ApiToken(token), err
+}
+
+func (s *Store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	feed, err := s.q.CreateFeed(ctx, CreateFeedParams(arg))
+	return database.Feed(feed), err
+}
+
+func (s *Store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	row, err := s.q.CreateFeedFollow(ctx, CreateFeedFollowParams(arg))
+	return database.CreateFeedFollowRow(row), err
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user, err := s.q.CreateUser(ctx, CreateUserParams(arg))
+	return database.User(user), err
+}
+
+func (s *Store) DeleteAPIToken(ctx context.Context, arg database.DeleteAPITokenParams) (int64, error) {
+	return s.q.DeleteAPIToken(ctx, DeleteAPITokenParams(arg))
+}
+
+func (s *Store) DeleteFeed(ctx context.Context, arg database.DeleteFeedParams) (int64, error) {
+	return s.q.DeleteFeed(ctx, DeleteFeedParams(arg))
+}
+
+func (s *Store) DeleteFollows(ctx context.Context, arg database.DeleteFollowsParams) error {
+	return s.q.DeleteFollows(ctx, DeleteFollowsParams(arg))
+}
+
+func (s *Store) DeleteSavedPost(ctx context.Context, arg database.DeleteSavedPostParams) (int64, error) {
+	return s.q.DeleteSavedPost(ctx, DeleteSavedPostParams(arg))
+}
+
+func (s *Store) DeleteUsers(ctx context.Context) error {
+	return s.q.DeleteUsers(ctx)
+}
+
+func (s *Store) ExtendFeedLease(ctx context.Context, arg database.ExtendFeedLeaseParams) (int64, error) {
+	return s.q.ExtendFeedLease(ctx, ExtendFeedLeaseParams(arg))
+}
+
+func (s *Store) GetAPITokensForUser(ctx context.Context, userID uuid.UUID) ([]database.ApiToken, error) {
+	rows, err := s.q.GetAPITokensForUser(ctx, userID)
+	return convertRows(rows, func(r ApiToken) database.ApiToken {
+		return database.ApiToken(r)
+	}), err
+}
+
+func (s *Store) GetFeedByURL(ctx context.Context, url string) (database.Feed, error) {
+	feed, err := s.q.GetFeedByURL(ctx, url)
+	return database.Feed(feed), err
+}
+
+func (s *Store) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	rows, err := s.q.GetFeedFollowsForUser(ctx, userID)
+	return convertRows(rows, func(r GetFeedFollowsForUserRow) database.GetFeedFollowsForUserRow {
+		return database.GetFeedFollowsForUserRow(r)
+	}), err
+}
+
+func (s *Store) GetFeeds(ctx context.Context) ([]database.GetFeedsRow, error) {
+	rows, err := s.q.GetFeeds(ctx)
+	return convertRows(rows, func(r GetFeedsRow) database.GetFeedsRow {
+		return database.GetFeedsRow(r)
+	}), err
+}
+
+func (s *Store) GetPostForUser(ctx context.Context, arg database.GetPostForUserParams) ([]database.GetPostForUserRow, error) {
+	rows, err := s.q.GetPostForUser(ctx, GetPostForUserParams(arg))
+	return convertRows(rows, func(r GetPostForUserRow) database.GetPostForUserRow {
+		return database.GetPostForUserRow{
+			ID:                     r.ID,
+			CreatedAt:              r.CreatedAt,
+			UpdatedAt:              r.UpdatedAt,
+			Title:                  r.Title,
+			Url:                    r.Url,
+			Description:            r.Description,
+			PublishedAt:            r.PublishedAt,
+			FeedID:                 r.FeedID,
+			PublishedAtSynthesized: r.PublishedAtSynthesized,
+			Guid:                   r.Guid,
+			FeedName:               r.FeedName,
+		}
+	}), err
+}
+
+func (s *Store) GetSavedPostsForUser(ctx context.Context, arg database.GetSavedPostsForUserParams) ([]database.SavedPost, error) {
+	rows, err := s.q.GetSavedPostsForUser(ctx, GetSavedPostsForUserParams(arg))
+	return convertRows(rows, func(r SavedPost) database.SavedPost {
+		return database.SavedPost(r)
+	}), err
+}
+
+func (s *Store) GetUser(ctx context.Context, name string) (database.User, error) {
+	user, err := s.q.GetUser(ctx, name)
+	return database.User(user), err
+}
+
+func (s *Store) GetUserByAPIToken(ctx context.Context, tokenHash string) (database.GetUserByAPITokenRow, error) {
+	row, err := s.q.GetUserByAPIToken(ctx, tokenHash)
+	return database.GetUserByAPITokenRow(row), err
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	rows, err := s.q.GetUsers(ctx)
+	return convertRows(rows, func(r User) database.User {
+		return database.User(r)
+	}), err
+}
+
+func (s *Store) MarkAPITokenUsed(ctx context.Context, arg database.MarkAPITokenUsedParams) error {
+	return s.q.MarkAPITokenUsed(ctx, MarkAPITokenUsedParams{
+		LastUsedAt: sql.NullTime{Time: arg.LastUsedAt, Valid: true},
+		ID:         arg.ID,
+	})
+}
+
+func (s *Store) MarkFeedFetchFailed(ctx context.Context, arg database.MarkFeedFetchFailedParams) (database.Feed, error) {
+	feed, err := s.q.MarkFeedFetchFailed(ctx, MarkFeedFetchFailedParams(arg))
+	return database.Feed(feed), err
+}
+
+func (s *Store) MarkFeedFetched(ctx context.Context, arg database.MarkFeedFetchedParams) (database.Feed, error) {
+	feed, err := s.q.MarkFeedFetched(ctx, MarkFeedFetchedParams{ID: arg.ID, LastStatus: arg.LastStatus})
+	return database.Feed(feed), err
+}
+
+func (s *Store) MarkFeedRead(ctx context.Context, arg database.MarkFeedReadParams) (int64, error) {
+	return s.q.MarkFeedRead(ctx, MarkFeedReadParams(arg))
+}
+
+func (s *Store) MarkFeedUnread(ctx context.Context, arg database.MarkFeedUnreadParams) (int64, error) {
+	return s.q.MarkFeedUnread(ctx, MarkFeedUnreadParams(arg))
+}
+
+func (s *Store) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	return s.q.MarkPostRead(ctx, MarkPostReadParams(arg))
+}
+
+func (s *Store) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) error {
+	return s.q.MarkPostUnread(ctx, MarkPostUnreadParams(arg))
+}
+
+func (s *Store) MarkPostsReadBefore(ctx context.Context, arg database.MarkPostsReadBeforeParams) (int64, error) {
+	return s.q.MarkPostsReadBefore(ctx, MarkPostsReadBeforeParams(arg))
+}
+
+// MergeFeedInto runs the steps of the Postgres query of the same name in a
+// transaction.
+func (s *Store) MergeFeedInto(ctx context.Context, arg database.MergeFeedIntoParams) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := New(utcDB{tx})
+	if err := q.MoveFollowsInto(ctx, MoveFollowsIntoParams{IntoID: arg.IntoID, FromID: arg.FromID}); err != nil {
+		return fmt.Errorf("failed to move follows: %w", err)
+	}
+	if err := q.CopyReadsInto(ctx, CopyReadsIntoParams{FromID: arg.FromID, IntoID: arg.IntoID}); err != nil {
+		return fmt.Errorf("failed to copy read marks: %w", err)
+	}
+	if err := q.RelinkSavedPostsInto(ctx, RelinkSavedPostsIntoParams{FromID: arg.FromID, IntoID: arg.IntoID}); err != nil {
+		return fmt.Errorf("failed to relink saved posts: %w", err)
+	}
+	if err := q.MovePostsInto(ctx, MovePostsIntoParams{IntoID: arg.IntoID, FromID: arg.FromID}); err != nil {
+		return fmt.Errorf("failed to move posts: %w", err)
+	}
+	if err := q.MoveLeaseInto(ctx, MoveLeaseIntoParams{IntoID: arg.IntoID, FromID: arg.FromID}); err != nil {
+		return fmt.Errorf("failed to move the lease: %w", err)
+	}
+	if err := q.DeleteFeedByID(ctx, arg.FromID); err != nil {
+		return fmt.Errorf("failed to delete the merged feed: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *Store) MoveFeed(ctx context.Context, arg database.MoveFeedParams) error {
+	return s.q.MoveFeed(ctx, MoveFeedParams{Url: arg.Url, ID: arg.ID})
+}
+
+func (s *Store) ReleaseFeedLease(ctx context.Context, arg database.ReleaseFeedLeaseParams) error {
+	return s.q.ReleaseFeedLease(ctx, ReleaseFeedLeaseParams(arg))
+}
+
+func (s *Store) RenameFeed(ctx context.Context, arg database.RenameFeedParams) (database.Feed, error) {
+	feed, err := s.q.RenameFeed(ctx, RenameFeedParams{Name: arg.Name, ID: arg.ID, UserID: arg.UserID})
+	return database.Feed(feed), err
+}
+
+func (s *Store) SavePost(ctx context.Context, arg database.SavePostParams) (database.SavedPost, error) {
+	saved, err := s.q.SavePost(ctx, SavePostParams(arg))
+	return database.SavedPost(saved), err
+}
+
+func (s *Store) SearchPostsForUser(ctx context.Context, arg database.SearchPostsForUserParams) ([]database.SearchPostsForUserRow, error) {
+	arg.Query = matchExpression(arg.Query)
+	if arg.Query == "" {
+		// websearch_to_tsquery matches nothing for a query without terms,
+		// while FTS4 rejects an empty MATCH.
+		return nil, nil
+	}
+	rows, err := s.q.SearchPostsForUser(ctx, SearchPostsForUserParams(arg))
+	return convertRows(rows, func(r SearchPostsForUserRow) database.SearchPostsForUserRow {
+		return database.SearchPostsForUserRow(r)
+	}), err
+}
+
+func (s *Store) UpdateFeedCacheHeaders(ctx context.Context, arg database.UpdateFeedCacheHeadersParams) error {
+	return s.q.UpdateFeedCacheHeaders(ctx, UpdateFeedCacheHeadersParams{
+		Etag:         arg.Etag,
+		LastModified: arg.LastModified,
+		ID:           arg.ID,
+	})
+}
+
+func (s *Store) UpdateFeedURL(ctx context.Context, arg database.UpdateFeedURLParams) (database.Feed, error) {
+	feed, err := s.q.UpdateFeedURL(ctx, UpdateFeedURLParams{Url: arg.Url, ID: arg.ID, UserID: arg.UserID})
+	return database.Feed(feed), err
+}
+
+func (s *Store) UpsertPost(ctx context.Context, arg database.UpsertPostParams) (database.UpsertPostRow, error) {
+	row, err := s.q.UpsertPost(ctx, UpsertPostParams(arg))
+	return database.UpsertPostRow(row), err
+}
+
+func convertFeeds(feeds []Feed) []database.Feed {
+	return convertRows(feeds, func(f Feed) database.Feed { return database.Feed(f) })
+}
+
+func convertRows[From, To any](rows []From, convert func(From) To) []To {
+	if rows == nil {
+		return nil
+	}
+	converted := make([]To, len(rows))
+	for i, row := range rows {
+		converted[i] = convert(row)
+	}
+	return converted
+}
+
+// matchExpression translates a query in the web search syntax the search
+// command takes (words, "quoted phrases", or, and -excluded words) into an
+// FTS4 MATCH expression. Every word is quoted, so nothing the user types is
+// taken as FTS4 syntax.
+func matchExpression(query string) string {
+	var groups []string
+	var include, exclude []string
+	flush := func() {
+		if len(include) > 0 {
+			group := strings.Join(include, " ")
+			for _, term := range exclude {
+				group += " NOT " + term
+			}
+			groups = append(groups, "("+group+")")
+		}
+		include, exclude = nil, nil
+	}
+	negate := false
+	for len(query) > 0 {
+		r := rune(query[0])
+		if r == '-' {
+			negate = true
+			query = query[1:]
+			continue
+		}
+		if unicode.IsSpace(r) {
+			negate = false
+			query = query[1:]
+			continue
+		}
+		var term string
+		if r == '"' {
+			phrase, rest, _ := strings.Cut(query[1:], `"`)
+			term, query = phrase, rest
+		} else {
+			end := strings.IndexFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(query)
+			}
+			term, query = query[:end], query[end:]
+			if strings.EqualFold(term, "or") && !negate {
+				flush()
+				continue
+			}
+		}
+		words := strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if len(words) > 0 {
+			quoted := `"` + strings.Join(words, " ") + `"`
+			if negate {
+				exclude = append(exclude, quoted)
+			} else {
+				include = append(include, quoted)
+			}
+		}
+		negate = false
+	}
+	flush()
+	return strings.Join(groups, " OR ")
+}
@@ -0,0 +1,432 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/Kam1217/blog_aggregator/internal/migrate"
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, migrate.SQLite, os.DirFS("../../sql/sqlite/schema"))
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return NewStore(db)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	// A zone other than UTC, to check times still compare correctly.
+	zone := time.FixedZone("UTC-7", -7*60*60)
+	now := time.Now().In(zone).Truncate(time.Millisecond)
+
+	user, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "kam"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if !user.CreatedAt.Equal(now) {
+		t.Errorf("expected created_at %v but got %v", now, user.CreatedAt)
+	}
+	if _, err := s.GetUser(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown user but got: %v", err)
+	}
+
+	feed, err := s.CreateFeed(ctx, database.CreateFeedParams{
+		ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "blog", Url: "https://example.com/feed", UserID: user.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to create feed: %v", err)
+	}
+	follow, err := s.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID, FeedID: feed.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to follow feed: %v", err)
+	}
+	if follow.UserName != "kam" || follow.FeedName != "blog" {
+		t.Errorf("expected the follow to name the user and feed but got %+v", follow)
+	}
+
+	t.Run("claim feeds", func(t *testing.T) {
+		claimed, err := s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: "test", LeaseSeconds: 60, DueBefore: now, BatchSize: 10,
+		})
+		if err != nil {
+			t.Fatalf("failed to claim feeds: %v", err)
+		}
+		if len(claimed) != 1 || claimed[0].LeaseOwner.String != "test" {
+			t.Fatalf("expected the feed to be claimed but got %+v", claimed)
+		}
+		again, err := s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: "other", LeaseSeconds: 60, DueBefore: now, BatchSize: 10,
+		})
+		if err != nil || len(again) != 0 {
+			t.Errorf("expected a leased feed not to be claimed again but got %d, %v", len(again), err)
+		}
+		fetched, err := s.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+			ID: feed.ID, LastStatus: sql.NullInt32{Int32: 200, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("failed to mark feed fetched: %v", err)
+		}
+		if fetched.LeaseOwner.Valid || !fetched.LastFetchedAt.Valid || fetched.LastStatus.Int32 != 200 {
+			t.Errorf("expected the lease to be released and the fetch recorded but got %+v", fetched)
+		}
+	})
+
+	published := []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Hour).UTC()}
+	var postIDs []uuid.UUID
+	for i, title := range []string{"Generic types in Go", "Kubernetes networking"} {
+		row, err := s.UpsertPost(ctx, database.UpsertPostParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Title: title, Url: "https://example.com/" + title,
+			Description: sql.NullString{String: "A post about " + title, Valid: true},
+			PublishedAt: published[i], FeedID: feed.ID, Guid: title,
+		})
+		if err != nil || !row.Inserted {
+			t.Fatalf("expected post %q to be inserted but got %+v, %v", title, row, err)
+		}
+		postIDs = append(postIDs, row.ID)
+	}
+
+	t.Run("upsert", func(t *testing.T) {
+		arg := database.UpsertPostParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Title: "Generic types in Go", Url: "https://example.com/Generic types in Go",
+			Description: sql.NullString{String: "A post about Generic types in Go", Valid: true},
+			PublishedAt: published[0], FeedID: feed.ID, Guid: "Generic types in Go",
+		}
+		if _, err := s.UpsertPost(ctx, arg); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected an unchanged post to be skipped but got: %v", err)
+		}
+		arg.Title = "Generic types in Go 1.18"
+		row, err := s.UpsertPost(ctx, arg)
+		if err != nil || row.Inserted || row.ID != postIDs[0] {
+			t.Errorf("expected post %s to be updated but got %+v, %v", postIDs[0], row, err)
+		}
+	})
+
+	t.Run("adopt legacy guid", func(t *testing.T) {
+		unfollowed, err := s.CreateFeed(ctx, database.CreateFeedParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "legacy", Url: "https://legacy.example.com/feed", UserID: user.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to create feed: %v", err)
+		}
+		link := "https://legacy.example.com/post"
+		legacy, err := s.UpsertPost(ctx, database.UpsertPostParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Title: "Legacy", Url: link,
+			PublishedAt: now.Add(-3 * time.Hour), FeedID: unfollowed.ID, Guid: link,
+		})
+		if err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+		arg := database.AdoptLegacyPostGUIDParams{Guid: "urn:legacy", FeedID: unfollowed.ID, Url: link}
+		if n, err := s.AdoptLegacyPostGUID(ctx, arg); err != nil || n != 1 {
+			t.Fatalf("expected the post to be re-keyed but got %d, %v", n, err)
+		}
+		if n, err := s.AdoptLegacyPostGUID(ctx, arg); err != nil || n != 0 {
+			t.Errorf("expected nothing left to re-key but got %d, %v", n, err)
+		}
+		row, err := s.UpsertPost(ctx, database.UpsertPostParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Title: "Legacy, renamed", Url: link,
+			PublishedAt: now.Add(-3 * time.Hour), FeedID: unfollowed.ID, Guid: "urn:legacy",
+		})
+		if err != nil || row.Inserted || row.ID != legacy.ID {
+			t.Errorf("expected post %s to be updated but got %+v, %v", legacy.ID, row, err)
+		}
+	})
+
+	t.Run("browse", func(t *testing.T) {
+		if err := s.MarkPostRead(ctx, database.MarkPostReadParams{UserID: user.ID, PostID: postIDs[1]}); err != nil {
+			t.Fatalf("failed to mark post read: %v", err)
+		}
+		posts, err := s.GetPostForUser(ctx, database.GetPostForUserParams{UserID: user.ID, Limit: 10})
+		if err != nil {
+			t.Fatalf("failed to get posts: %v", err)
+		}
+		if len(posts) != 2 || posts[0].ID != postIDs[1] {
+			t.Errorf("expected the newest post first but got %+v", posts)
+		}
+		unread, err := s.GetPostForUser(ctx, database.GetPostForUserParams{UserID: user.ID, UnreadOnly: true, Limit: 10})
+		if err != nil {
+			t.Fatalf("failed to get unread posts: %v", err)
+		}
+		if len(unread) != 1 || unread[0].ID != postIDs[0] {
+			t.Errorf("expected only the unread post but got %+v", unread)
+		}
+		marked, err := s.MarkPostsReadBefore(ctx, database.MarkPostsReadBeforeParams{UserID: user.ID, Before: now})
+		if err != nil || marked != 1 {
+			t.Errorf("expected 1 post to be marked read but got %d, %v", marked, err)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		results, err := s.SearchPostsForUser(ctx, database.SearchPostsForUserParams{
+			Query: `"generic types" -java`, UserID: user.ID, MaxResults: 10,
+		})
+		if err != nil {
+			t.Fatalf("failed to search: %v", err)
+		}
+		if len(results) != 1 || results[0].ID != postIDs[0] {
+			t.Fatalf("expected the generics post but got %+v", results)
+		}
+		if results[0].Snippet == "" || results[0].Rank <= 0 {
+			t.Errorf("expected a ranked result with a snippet but got %+v", results[0])
+		}
+		results, err = s.SearchPostsForUser(ctx, database.SearchPostsForUserParams{
+			Query: "generics or kubernetes", UserID: user.ID, MaxResults: 10,
+			Since: sql.NullTime{Time: now.Add(-90 * time.Minute), Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("failed to search: %v", err)
+		}
+		if len(results) != 1 || results[0].ID != postIDs[1] {
+			t.Errorf("expected only the post published since then but got %+v", results)
+		}
+	})
+
+	t.Run("save keeps note", func(t *testing.T) {
+		arg := database.SavePostParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID, PostID: postIDs[0],
+			Note: sql.NullString{String: "read later", Valid: true},
+		}
+		if _, err := s.SavePost(ctx, arg); err != nil {
+			t.Fatalf("failed to save post: %v", err)
+		}
+		arg.ID, arg.Note = uuid.New(), sql.NullString{}
+		saved, err := s.SavePost(ctx, arg)
+		if err != nil || saved.Note.String != "read later" {
+			t.Errorf("expected saving again without a note to keep it but got %+v, %v", saved, err)
+		}
+	})
+
+	t.Run("search saved literally", func(t *testing.T) {
+		if _, err := s.SavePost(ctx, database.SavePostParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID, PostID: postIDs[1],
+			Note: sql.NullString{String: "100% done", Valid: true},
+		}); err != nil {
+			t.Fatalf("failed to save post: %v", err)
+		}
+		for search, want := range map[string]int{`\%`: 1, `\_`: 0, `100\% DONE`: 1, `later`: 1} {
+			saved, err := s.GetSavedPostsForUser(ctx, database.GetSavedPostsForUserParams{
+				UserID: user.ID, Search: sql.NullString{String: search, Valid: true},
+			})
+			if err != nil || len(saved) != want {
+				t.Errorf("expected %d saved posts for %q but got %d, %v", want, search, len(saved), err)
+			}
+		}
+		if _, err := s.DeleteSavedPost(ctx, database.DeleteSavedPostParams{UserID: user.ID, Ref: postIDs[1].String()}); err != nil {
+			t.Fatalf("failed to unsave post: %v", err)
+		}
+	})
+
+	t.Run("merge feeds", func(t *testing.T) {
+		other, err := s.CreateFeed(ctx, database.CreateFeedParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "mirror", Url: "https://mirror.example.com/feed", UserID: user.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to create feed: %v", err)
+		}
+		if _, err := s.SavePost(ctx, database.SavePostParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID, PostID: postIDs[0],
+		}); err != nil {
+			t.Fatalf("failed to save post: %v", err)
+		}
+		claimed, err := s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: "merger", LeaseSeconds: 60, DueBefore: now.Add(time.Hour), BatchSize: 10,
+		})
+		if err != nil {
+			t.Fatalf("failed to claim feeds: %v", err)
+		}
+		for _, c := range claimed {
+			if c.ID == feed.ID {
+				continue
+			}
+			if err := s.ReleaseFeedLease(ctx, database.ReleaseFeedLeaseParams{ID: c.ID, LeaseOwner: "merger"}); err != nil {
+				t.Fatalf("failed to release lease: %v", err)
+			}
+		}
+		if err := s.MergeFeedInto(ctx, database.MergeFeedIntoParams{IntoID: other.ID, FromID: feed.ID}); err != nil {
+			t.Fatalf("failed to merge feeds: %v", err)
+		}
+		if merged, err := s.GetFeedByURL(ctx, other.Url); err != nil || merged.LeaseOwner.String != "merger" || !merged.LeaseExpiresAt.Valid {
+			t.Errorf("expected the feed merged into to take over the lease but got %+v, %v", merged, err)
+		}
+		if _, err := s.GetFeedByURL(ctx, feed.Url); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected the merged feed to be deleted but got: %v", err)
+		}
+		follows, err := s.GetFeedFollowsForUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("failed to get follows: %v", err)
+		}
+		if len(follows) != 1 || follows[0].FeedID != other.ID || follows[0].UnreadCount != 0 {
+			t.Errorf("expected the follow and read posts to move to the other feed but got %+v", follows)
+		}
+		saved, err := s.GetSavedPostsForUser(ctx, database.GetSavedPostsForUserParams{
+			UserID: user.ID, Search: sql.NullString{String: "GENERIC", Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("failed to get saved posts: %v", err)
+		}
+		if len(saved) != 1 || saved[0].PostID.UUID != postIDs[0] {
+			t.Errorf("expected the saved post to stay linked but got %+v", saved)
+		}
+	})
+
+	t.Run("api tokens", func(t *testing.T) {
+		token, err := s.CreateAPIToken(ctx, database.CreateAPITokenParams{
+			ID: uuid.New(), CreatedAt: now, UserID: user.ID, Name: "dashboard", TokenHash: "hash", Scopes: "read",
+		})
+		if err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+		row, err := s.GetUserByAPIToken(ctx, "hash")
+		if err != nil || row.ID != user.ID || row.TokenID != token.ID || row.Scopes != "read" {
+			t.Fatalf("expected the token's owner but got %+v, %v", row, err)
+		}
+		if err := s.MarkAPITokenUsed(ctx, database.MarkAPITokenUsedParams{LastUsedAt: now, ID: token.ID}); err != nil {
+			t.Fatalf("failed to mark token used: %v", err)
+		}
+		tokens, err := s.GetAPITokensForUser(ctx, user.ID)
+		if err != nil || len(tokens) != 1 || !tokens[0].LastUsedAt.Time.Equal(now) {
+			t.Errorf("expected the token to be marked used but got %+v, %v", tokens, err)
+		}
+		deleted, err := s.DeleteAPIToken(ctx, database.DeleteAPITokenParams{UserID: user.ID, Ref: token.ID.String()})
+		if err != nil || deleted != 1 {
+			t.Errorf("expected the token to be revoked by id but got %d, %v", deleted, err)
+		}
+	})
+
+	t.Run("cascades", func(t *testing.T) {
+		if err := s.DeleteUsers(ctx); err != nil {
+			t.Fatalf("failed to delete users: %v", err)
+		}
+		feeds, err := s.GetFeeds(ctx)
+		if err != nil {
+			t.Fatalf("failed to get feeds: %v", err)
+		}
+		if len(feeds) != 0 {
+			t.Errorf("expected deleting users to delete their feeds but got %+v", feeds)
+		}
+	})
+}
+
+func TestClaimFeedsToFetch(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	now := time.Now()
+	user, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: "kam"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	const feeds = 20
+	for i := range feeds {
+		_, err := s.CreateFeed(ctx, database.CreateFeedParams{
+			ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Name: fmt.Sprintf("blog %d", i),
+			Url: fmt.Sprintf("https://example.com/%d/feed", i), UserID: user.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to create feed: %v", err)
+		}
+	}
+
+	t.Run("concurrent claimers", func(t *testing.T) {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			claimed = map[uuid.UUID]string{}
+		)
+		for w := range 8 {
+			wg.Add(1)
+			go func(owner string) {
+				defer wg.Done()
+				for {
+					batch, err := s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+						LeaseOwner: owner, LeaseSeconds: 60, DueBefore: now, BatchSize: 3,
+					})
+					if err != nil {
+						t.Errorf("failed to claim feeds: %v", err)
+						return
+					}
+					if len(batch) == 0 {
+						return
+					}
+					mu.Lock()
+					for _, feed := range batch {
+						if other, ok := claimed[feed.ID]; ok {
+							t.Errorf("feed %s was claimed by both %s and %s", feed.Name, other, owner)
+						}
+						claimed[feed.ID] = owner
+					}
+					mu.Unlock()
+				}
+			}(fmt.Sprintf("worker-%d", w))
+		}
+		wg.Wait()
+		if len(claimed) != feeds {
+			t.Errorf("expected all %d feeds to be claimed but got %d", feeds, len(claimed))
+		}
+	})
+
+	t.Run("expired lease", func(t *testing.T) {
+		expired, err := s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: "late", LeaseSeconds: 60, DueBefore: now, BatchSize: feeds,
+		})
+		if err != nil || len(expired) != 0 {
+			t.Fatalf("expected leased feeds not to be claimed again but got %d, %v", len(expired), err)
+		}
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE feeds SET lease_expires_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', '-1 seconds')`); err != nil {
+			t.Fatalf("failed to expire the leases: %v", err)
+		}
+		expired, err = s.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: "late", LeaseSeconds: 60, DueBefore: now, BatchSize: feeds,
+		})
+		if err != nil || len(expired) != feeds {
+			t.Fatalf("expected every expired lease to be claimed again but got %d, %v", len(expired), err)
+		}
+		n, err := s.ExtendFeedLease(ctx, database.ExtendFeedLeaseParams{LeaseSeconds: 60, ID: expired[0].ID, LeaseOwner: "worker-0"})
+		if err != nil || n != 0 {
+			t.Errorf("expected the previous owner not to extend a lost lease but got %d, %v", n, err)
+		}
+	})
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"go generics", `("go" "generics")`},
+		{`"generic types" -java`, `("generic types" NOT "java")`},
+		{"rust or go", `("rust") OR ("go")`},
+		{`c++ AND "x`, `("c" "AND" "x")`},
+		{"-only", ""},
+	}
+	for _, tt := range tests {
+		if got := matchExpression(tt.query); got != tt.want {
+			t.Errorf("matchExpression(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "strings"
+
+// JSONFeed is a JSON Feed 1.1 document (https://jsonfeed.org/version/1.1).
+// The singular author fields from version 1.0 are still read.
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []JSONFeedAuthor `json:"authors"`
+	Author        *JSONFeedAuthor  `json:"author"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (f *JSONFeed) toRSS() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = f.Title
+	feed.Channel.Link = f.HomePageURL
+	feed.Channel.Description = f.Description
+
+	for _, item := range f.Items {
+		description := item.ContentHTML
+		if description == "" {
+			description = item.Summary
+		}
+		if description == "" {
+			description = item.ContentText
+		}
+		published := item.DatePublished
+		if published == "" {
+			published = item.DateModified
+		}
+		authors := item.Authors
+		if len(authors) == 0 && item.Author != nil {
+			authors = []JSONFeedAuthor{*item.Author}
+		}
+		var names []string
+		for _, author := range authors {
+			if author.Name != "" {
+				names = append(names, author.Name)
+			}
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			Description: description,
+			PubDate:     normalizeDate(published),
+			GUID:        item.ID,
+			Author:      strings.Join(names, ", "),
+		})
+	}
+	return &feed
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/Kam1217/blog_aggregator/internal/config"
 	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/Kam1217/blog_aggregator/internal/migrate"
+	"github.com/Kam1217/blog_aggregator/internal/sqlitedb"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
@@ -24,27 +30,48 @@ func main() {
 		log.Fatal("failed to read config: ", err)
 	}
 
-	db, err := sql.Open("postgres", cfg.DbURL)
+	limits, err := cfg.FetchLimits()
+	if err != nil {
+		log.Fatal("invalid fetch settings in config: ", err)
+	}
+	setFetchLimits(limits)
+
+	db, dbQueries, dialect, err := openDatabase(cfg)
 	if err != nil {
 		log.Fatal("failed to open a connection to the database:", err)
 	}
-	dbQueries := database.New(db)
+	migrator, err := migrate.New(db, dialect, schemaMigrations(dialect))
+	if err != nil {
+		log.Fatal("failed to load the schema migrations: ", err)
+	}
 
-	programState := state{cfg: cfg, cfgManager: cfgMgr, db: dbQueries}
+	programState := state{cfg: cfg, cfgManager: cfgMgr, db: dbQueries, migrator: migrator}
 	cmds := commands{
-		registeredCommands: make(map[string]func(*state, command) error),
+		registeredCommands: make(map[string]func(context.Context, *state, command) error),
 	}
+	cmds.register("migrate", handlerMigrate)
 	cmds.register("login", handlerLogin)
 	cmds.register("register", handlerRegister)
 	cmds.register("reset", handlerReset)
 	cmds.register("users", handlerUsers)
 	cmds.register("agg", handlerAgg)
-	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
+	cmds.register("addfeed", middlewareLoggedIn(scopeManageFeeds, handlerAddFeed))
 	cmds.register("feeds", handlerListFeeds)
-	cmds.register("follow", middlewareLoggedIn(handlerFollow))
-	cmds.register("following", middlewareLoggedIn(handlerFollowing))
-	cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow))
-	cmds.register("browse", handlerBrowse)
+	cmds.register("feed", middlewareLoggedIn(scopeManageFeeds, handlerFeed))
+	cmds.register("follow", middlewareLoggedIn(scopeWrite, handlerFollow))
+	cmds.register("following", middlewareLoggedIn(scopeRead, handlerFollowing))
+	cmds.register("unfollow", middlewareLoggedIn(scopeWrite, handlerUnfollow))
+	cmds.register("browse", middlewareLoggedIn(scopeRead, handlerBrowse))
+	cmds.register("search", middlewareLoggedIn(scopeRead, handlerSearch))
+	cmds.register("mark-read", middlewareLoggedIn(scopeWrite, handlerMarkRead))
+	cmds.register("mark-unread", middlewareLoggedIn(scopeWrite, handlerMarkUnread))
+	cmds.register("save", middlewareLoggedIn(scopeWrite, handlerSave))
+	cmds.register("unsave", middlewareLoggedIn(scopeWrite, handlerUnsave))
+	cmds.register("saved", middlewareLoggedIn(scopeRead, handlerSaved))
+	cmds.register("import-opml", middlewareLoggedIn(scopeManageFeeds, handlerImportOPML))
+	cmds.register("export-opml", middlewareLoggedIn(scopeRead, handlerExportOPML))
+	cmds.register("token", handlerToken)
+	cmds.register("serve", handlerServe)
 
 	if len(os.Args) < 2 {
 		log.Fatal("not enough arguments provided")
@@ -52,7 +79,17 @@ func main() {
 	cmdName := os.Args[1]
 	cmdArgs := os.Args[2:]
 	cmd := command{name: cmdName, args: cmdArgs}
-	if err := cmds.run(&programState, cmd); err != nil {
+
+	// Cancel on Ctrl-C or SIGTERM so long running commands like agg can
+	// finish what they are doing and exit cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cmd.name != "migrate" {
+		if err := checkSchemaVersion(ctx, migrator); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if err := cmds.run(ctx, &programState, cmd); err != nil {
 		log.Fatal(err.Error())
 	}
 	_, err = cfgMgr.Read()
@@ -60,3 +97,24 @@ func main() {
 		log.Fatal("failed to read updated config: ", err)
 	}
 }
+
+// openDatabase opens the database cfg.DbURL points at, with the queries
+// written for it.
+func openDatabase(cfg *config.Config) (*sql.DB, database.Querier, migrate.Dialect, error) {
+	driver, dataSource, err := cfg.Database()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if driver == config.DriverSQLite {
+		// SQLite allows one writer at a time; sharing a single connection
+		// makes concurrent scrapes take turns instead of failing with
+		// "database is locked".
+		db.SetMaxOpenConns(1)
+		return db, sqlitedb.NewStore(db), migrate.SQLite, nil
+	}
+	return db, database.New(db), migrate.Postgres, nil
+}
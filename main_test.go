@@ -1,138 +1,735 @@
 package main
 
-// import (
-// 	"encoding/json"
-// 	"errors"
-// 	"os"
-// 	"path/filepath"
-// 	"testing"
-
-// 	"github.com/Kam1217/blog_aggregator/internal/config"
-// )
-
-// func TestCommandsRegister(t *testing.T) {
-// 	cmds := commands{
-// 		registeredCommands: make(map[string]func(*state, command) error),
-// 	}
-
-// 	testHandler := func(s *state, cmd command) error {
-// 		return nil
-// 	}
-
-// 	t.Run("Register single command", func(t *testing.T) {
-// 		cmds.register("test", testHandler)
-// 		if len(cmds.registeredCommands) != 1 {
-// 			t.Errorf("Expected 1 registered command but got %d", len(cmds.registeredCommands))
-// 		}
-
-// 		if cmds.registeredCommands["test"] == nil {
-// 			t.Errorf("Expected 'test' command to be registered")
-// 		}
-// 	})
-
-// 	t.Run("Register multiple commands", func(t *testing.T) {
-// 		cmds.register("test_2", testHandler)
-// 		if len(cmds.registeredCommands) != 2 {
-// 			t.Errorf("Expected 2 registered commands but got %d", len(cmds.registeredCommands))
-// 		}
-// 	})
-// }
-
-// func TestCommandRun(t *testing.T) {
-// 	cmds := commands{
-// 		registeredCommands: make(map[string]func(*state, command) error),
-// 	}
-
-// 	cfg := &config.Config{DbURL: "test_db", CurrentUserName: ""}
-// 	cfgMgr := &config.ConfigManager{Path: "/temp/test"}
-// 	s := &state{cfg: cfg, cfgManager: cfgMgr}
-
-// 	successHandler := func(s *state, cmd command) error {
-// 		return nil
-// 	}
-
-// 	failedHandler := func(s *state, cmd command) error {
-// 		return errors.New("failed handler")
-// 	}
-
-// 	cmds.register("success", successHandler)
-// 	cmds.register("fail", failedHandler)
-
-// 	t.Run("No command", func(t *testing.T) {
-// 		cmd := command{name: "nonexistent", args: []string{}}
-// 		err := cmds.run(s, cmd)
-// 		if err == nil {
-// 			t.Error("Expected error for non-existent command")
-// 		}
-// 	})
-
-// 	t.Run("Success command", func(t *testing.T) {
-// 		cmd := command{name: "success", args: []string{}}
-// 		err := cmds.run(s, cmd)
-// 		if err != nil {
-// 			t.Errorf("Expected no error but got: %v", err)
-// 		}
-// 	})
-
-// 	t.Run("Fail command", func(t *testing.T) {
-// 		cmd := command{name: "fail", args: []string{}}
-// 		err := cmds.run(s, cmd)
-// 		if err == nil {
-// 			t.Errorf("Expected error from failer handler")
-// 		}
-// 	})
-// }
-
-// func TestHandlerLogin(t *testing.T) {
-// 	tempDir := t.TempDir()
-// 	configPath := filepath.Join(tempDir, "test_gatorconfig.jason")
-// 	cfgMgr := &config.ConfigManager{Path: configPath}
-
-// 	expectedConf := &config.Config{DbURL: "postgres://example", CurrentUserName: ""}
-// 	data, err := json.Marshal(expectedConf)
-// 	if err != nil {
-// 		t.Errorf("Failed to marshal:%v", err)
-// 	}
-
-// 	if err := os.WriteFile(configPath, data, 0644); err != nil {
-// 		t.Fatalf("failed to write config: %v", err)
-// 	}
-
-// 	cfg, err := cfgMgr.Read()
-// 	if err != nil {
-// 		t.Fatalf("failed to read config: %v", err)
-// 	}
-
-// 	s := &state{cfg: cfg, cfgManager: cfgMgr}
-
-// 	t.Run("No arguments", func(t *testing.T) {
-// 		cmd := command{name: "login", args: []string{}}
-// 		err := handlerLogin(s, cmd)
-// 		if err == nil {
-// 			t.Errorf("Expected error when no arguments provided")
-// 		}
-// 	})
-
-// 	t.Run("Valid username", func(t *testing.T) {
-// 		cmd := command{name: "login", args: []string{"test_user"}}
-// 		err := handlerLogin(s, cmd)
-// 		if err != nil {
-// 			t.Errorf("Expected no error but got: %v", err)
-// 		}
-
-// 		updatedCfg, err := cfgMgr.Read()
-// 		if err != nil {
-// 			t.Fatalf("Failed to read upadated config: %v", err)
-// 		}
-
-// 		if updatedCfg.CurrentUserName != "test_user" {
-// 			t.Errorf("Expected username 'test_user' but got: %s", updatedCfg.CurrentUserName)
-// 		}
-
-// 		if updatedCfg.DbURL != expectedConf.DbURL {
-// 			t.Errorf("Expected DbURL to remain %s but got %s", expectedConf.DbURL, updatedCfg.DbURL)
-// 		}
-// 	})
-// }
-
-//TODO:Register, update login and getusers
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/config"
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/Kam1217/blog_aggregator/internal/memstore"
+	"github.com/google/uuid"
+)
+
+// newTestState returns a state backed by an in-memory store and a config
+// file in a temporary directory.
+func newTestState(t *testing.T) (*state, *memstore.Store) {
+	t.Helper()
+	cfgMgr := &config.ConfigManager{Path: filepath.Join(t.TempDir(), "test_gatorconfig.json")}
+	data, err := json.Marshal(&config.Config{DbURL: "postgres://example"})
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(cfgMgr.Path, data, 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := cfgMgr.Read()
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	store := memstore.New()
+	return &state{cfg: cfg, cfgManager: cfgMgr, db: store}, store
+}
+
+func createTestUser(t *testing.T, s *state, name string) database.User {
+	t.Helper()
+	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      name,
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+func createTestFeed(t *testing.T, s *state, user database.User, name, url string) database.Feed {
+	t.Helper()
+	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      name,
+		Url:       url,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to create feed: %v", err)
+	}
+	return feed
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	ferr := f()
+	w.Close()
+	return <-out, ferr
+}
+
+func TestCommandsRegister(t *testing.T) {
+	cmds := commands{
+		registeredCommands: make(map[string]func(context.Context, *state, command) error),
+	}
+
+	testHandler := func(ctx context.Context, s *state, cmd command) error {
+		return nil
+	}
+
+	t.Run("Register single command", func(t *testing.T) {
+		cmds.register("test", testHandler)
+		if len(cmds.registeredCommands) != 1 {
+			t.Errorf("Expected 1 registered command but got %d", len(cmds.registeredCommands))
+		}
+		if cmds.registeredCommands["test"] == nil {
+			t.Errorf("Expected 'test' command to be registered")
+		}
+	})
+
+	t.Run("Register multiple commands", func(t *testing.T) {
+		cmds.register("test_2", testHandler)
+		if len(cmds.registeredCommands) != 2 {
+			t.Errorf("Expected 2 registered commands but got %d", len(cmds.registeredCommands))
+		}
+	})
+}
+
+func TestCommandRun(t *testing.T) {
+	cmds := commands{
+		registeredCommands: make(map[string]func(context.Context, *state, command) error),
+	}
+	s, _ := newTestState(t)
+	ctx := context.Background()
+
+	cmds.register("success", func(ctx context.Context, s *state, cmd command) error {
+		return nil
+	})
+	cmds.register("fail", func(ctx context.Context, s *state, cmd command) error {
+		return errors.New("failed handler")
+	})
+
+	t.Run("No command", func(t *testing.T) {
+		if err := cmds.run(ctx, s, command{name: "nonexistent"}); err == nil {
+			t.Error("Expected error for non-existent command")
+		}
+	})
+
+	t.Run("Success command", func(t *testing.T) {
+		if err := cmds.run(ctx, s, command{name: "success"}); err != nil {
+			t.Errorf("Expected no error but got: %v", err)
+		}
+	})
+
+	t.Run("Fail command", func(t *testing.T) {
+		if err := cmds.run(ctx, s, command{name: "fail"}); err == nil {
+			t.Errorf("Expected error from failed handler")
+		}
+	})
+}
+
+func TestHandlerRegister(t *testing.T) {
+	s, store := newTestState(t)
+	ctx := context.Background()
+
+	t.Run("No arguments", func(t *testing.T) {
+		if err := handlerRegister(ctx, s, command{name: "register"}); err == nil {
+			t.Errorf("Expected error when no arguments provided")
+		}
+	})
+
+	t.Run("New user", func(t *testing.T) {
+		if _, err := captureStdout(t, func() error {
+			return handlerRegister(ctx, s, command{name: "register", args: []string{"test_user"}})
+		}); err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if _, err := store.GetUser(ctx, "test_user"); err != nil {
+			t.Errorf("Expected user to be created but got: %v", err)
+		}
+		updatedCfg, err := s.cfgManager.Read()
+		if err != nil {
+			t.Fatalf("Failed to read updated config: %v", err)
+		}
+		if updatedCfg.CurrentUserName != "test_user" {
+			t.Errorf("Expected username 'test_user' but got: %s", updatedCfg.CurrentUserName)
+		}
+	})
+
+	t.Run("Existing user", func(t *testing.T) {
+		err := handlerRegister(ctx, s, command{name: "register", args: []string{"test_user"}})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected an 'already exists' error but got: %v", err)
+		}
+	})
+}
+
+func TestHandlerLogin(t *testing.T) {
+	s, _ := newTestState(t)
+	ctx := context.Background()
+	createTestUser(t, s, "test_user")
+
+	t.Run("No arguments", func(t *testing.T) {
+		if err := handlerLogin(ctx, s, command{name: "login"}); err == nil {
+			t.Errorf("Expected error when no arguments provided")
+		}
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		err := handlerLogin(ctx, s, command{name: "login", args: []string{"nobody"}})
+		if err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Expected a 'does not exist' error but got: %v", err)
+		}
+		if s.cfg.CurrentUserName != "" {
+			t.Errorf("Expected the config to be left alone but got user: %s", s.cfg.CurrentUserName)
+		}
+	})
+
+	t.Run("Valid username", func(t *testing.T) {
+		if _, err := captureStdout(t, func() error {
+			return handlerLogin(ctx, s, command{name: "login", args: []string{"test_user"}})
+		}); err != nil {
+			t.Errorf("Expected no error but got: %v", err)
+		}
+		updatedCfg, err := s.cfgManager.Read()
+		if err != nil {
+			t.Fatalf("Failed to read updated config: %v", err)
+		}
+		if updatedCfg.CurrentUserName != "test_user" {
+			t.Errorf("Expected username 'test_user' but got: %s", updatedCfg.CurrentUserName)
+		}
+		if updatedCfg.DbURL != "postgres://example" {
+			t.Errorf("Expected DbURL to remain postgres://example but got %s", updatedCfg.DbURL)
+		}
+	})
+}
+
+func TestHandlerFollow(t *testing.T) {
+	s, store := newTestState(t)
+	ctx := context.Background()
+	owner := createTestUser(t, s, "owner")
+	reader := createTestUser(t, s, "reader")
+	feed := createTestFeed(t, s, owner, "Boot.dev Blog", "https://blog.boot.dev/index.xml")
+
+	t.Run("Unknown feed", func(t *testing.T) {
+		err := handlerFollow(ctx, s, command{name: "follow", args: []string{"https://example.com/feed"}}, reader)
+		if err == nil {
+			t.Errorf("Expected error for a feed that was never added")
+		}
+	})
+
+	t.Run("Follow", func(t *testing.T) {
+		out, err := captureStdout(t, func() error {
+			return handlerFollow(ctx, s, command{name: "follow", args: []string{feed.Url}}, reader)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if !strings.Contains(out, "reader is now following Boot.dev Blog") {
+			t.Errorf("Unexpected output: %q", out)
+		}
+		follows, err := store.GetFeedFollowsForUser(ctx, reader.ID)
+		if err != nil {
+			t.Fatalf("failed to get follows: %v", err)
+		}
+		if len(follows) != 1 || follows[0].FeedID != feed.ID {
+			t.Errorf("Expected reader to follow %s but got %+v", feed.Url, follows)
+		}
+	})
+
+	t.Run("Follow twice", func(t *testing.T) {
+		err := handlerFollow(ctx, s, command{name: "follow", args: []string{feed.Url}}, reader)
+		if !errors.Is(err, memstore.ErrUniqueViolation) {
+			t.Errorf("Expected a unique violation but got: %v", err)
+		}
+	})
+
+	t.Run("Deleting the feed drops its follows", func(t *testing.T) {
+		if _, err := store.DeleteFeed(ctx, database.DeleteFeedParams{ID: feed.ID, UserID: owner.ID}); err != nil {
+			t.Fatalf("failed to delete feed: %v", err)
+		}
+		follows, err := store.GetFeedFollowsForUser(ctx, reader.ID)
+		if err != nil {
+			t.Fatalf("failed to get follows: %v", err)
+		}
+		if len(follows) != 0 {
+			t.Errorf("Expected no follows left but got %d", len(follows))
+		}
+	})
+}
+
+func TestHandlerFeed(t *testing.T) {
+	s, store := newTestState(t)
+	ctx := context.Background()
+	owner := createTestUser(t, s, "owner")
+	reader := createTestUser(t, s, "reader")
+	feed := createTestFeed(t, s, owner, "Boot.dev Blog", "https://blog.boot.dev/index.xml")
+	other := createTestFeed(t, s, reader, "Go Blog", "https://go.dev/blog/feed.atom")
+	runFeed := func(user database.User, args ...string) (string, error) {
+		return captureStdout(t, func() error {
+			return handlerFeed(ctx, s, command{name: "feed", args: args}, user)
+		})
+	}
+
+	t.Run("Usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			{feed.Url, "bogus"},
+			{"bogus", feed.Url},
+			{"rename", "https://example.com/missing"},
+			{"delete", "https://example.com/missing", "extra"},
+		} {
+			_, err := runFeed(owner, args...)
+			if err == nil || !strings.HasPrefix(err.Error(), "usage:") {
+				t.Errorf("%q: Expected a usage error before looking the feed up but got: %v", args, err)
+			}
+		}
+		for _, args := range [][]string{
+			{"rename", feed.Url, "Renamed", "--no-verify"},
+			{"delete", feed.Url, "--no-verify"},
+		} {
+			_, err := runFeed(owner, args...)
+			if err == nil || !strings.Contains(err.Error(), "no-verify") {
+				t.Errorf("%q: Expected --no-verify to be rejected but got: %v", args, err)
+			}
+		}
+		if _, err := store.GetFeedByURL(ctx, feed.Url); err != nil {
+			t.Errorf("Expected the feed to be left alone but got: %v", err)
+		}
+	})
+
+	t.Run("Not the owner", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"rename", feed.Url, "Mine now"},
+			{"set-url", feed.Url, "https://example.com/feed", "--no-verify"},
+			{"delete", feed.Url},
+		} {
+			_, err := runFeed(reader, args...)
+			if err == nil || !strings.Contains(err.Error(), "added by another user") {
+				t.Errorf("%s: Expected the non-owner to be refused but got: %v", args[0], err)
+			}
+		}
+		unchanged, err := store.GetFeedByURL(ctx, feed.Url)
+		if err != nil || unchanged.Name != feed.Name {
+			t.Errorf("Expected the feed to be left alone but got %+v, %v", unchanged, err)
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		if _, err := runFeed(owner, "rename", feed.Url, "The Boot.dev Blog"); err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		renamed, err := store.GetFeedByURL(ctx, feed.Url)
+		if err != nil || renamed.Name != "The Boot.dev Blog" {
+			t.Errorf("Expected the feed to be renamed but got %+v, %v", renamed, err)
+		}
+	})
+
+	t.Run("Set URL taken by another feed", func(t *testing.T) {
+		_, err := runFeed(owner, "set-url", feed.Url, other.Url, "--no-verify")
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected an 'already exists' error but got: %v", err)
+		}
+		if _, err := store.GetFeedByURL(ctx, feed.Url); err != nil {
+			t.Errorf("Expected the feed to keep its URL but got: %v", err)
+		}
+	})
+
+	t.Run("Set URL resets the fetch state", func(t *testing.T) {
+		err := store.UpdateFeedCacheHeaders(ctx, database.UpdateFeedCacheHeadersParams{
+			ID:   feed.ID,
+			Etag: sql.NullString{String: `"v1"`, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("failed to store cache headers: %v", err)
+		}
+		_, err = store.MarkFeedFetchFailed(ctx, database.MarkFeedFetchFailedParams{
+			LastError:      "HTTP 404",
+			LastStatus:     sql.NullInt32{Int32: 404, Valid: true},
+			BackoffSeconds: 3600,
+			MaxFailures:    1,
+			ID:             feed.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to record a failed fetch: %v", err)
+		}
+
+		if _, err := runFeed(owner, "set-url", feed.Url, "https://blog.boot.dev/feed.xml", "--no-verify"); err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		moved, err := store.GetFeedByURL(ctx, "https://blog.boot.dev/feed.xml")
+		if err != nil {
+			t.Fatalf("Expected the feed under its new URL but got: %v", err)
+		}
+		if moved.ID != feed.ID {
+			t.Errorf("Expected feed %s to move but got %s", feed.ID, moved.ID)
+		}
+		if moved.Etag.Valid || moved.LastStatus.Valid || moved.LastError.Valid || moved.ConsecutiveFailures != 0 ||
+			moved.NextFetchAt.Valid || moved.DisabledAt.Valid {
+			t.Errorf("Expected the fetch and failure state to be reset but got %+v", moved)
+		}
+		feed = moved
+	})
+
+	t.Run("Delete cascades", func(t *testing.T) {
+		_, err := store.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+			ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: reader.ID, FeedID: feed.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to follow feed: %v", err)
+		}
+		post, err := store.UpsertPost(ctx, database.UpsertPostParams{
+			ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Title: "A post",
+			Url: "https://blog.boot.dev/a-post", PublishedAt: time.Now(), FeedID: feed.ID, Guid: "a-post",
+		})
+		if err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+
+		out, err := runFeed(owner, "delete", feed.Url)
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if !strings.Contains(out, "Deleted feed The Boot.dev Blog") {
+			t.Errorf("Unexpected output: %q", out)
+		}
+		if _, err := store.GetFeedByURL(ctx, feed.Url); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected the feed to be deleted but got: %v", err)
+		}
+		follows, err := store.GetFeedFollowsForUser(ctx, reader.ID)
+		if err != nil || len(follows) != 0 {
+			t.Errorf("Expected the follows to be deleted but got %+v, %v", follows, err)
+		}
+		err = store.MarkPostRead(ctx, database.MarkPostReadParams{UserID: reader.ID, PostID: post.ID})
+		if !errors.Is(err, memstore.ErrForeignKeyViolation) {
+			t.Errorf("Expected the post to be deleted with its feed but got: %v", err)
+		}
+	})
+}
+
+func TestScrapeFeedsAndBrowse(t *testing.T) {
+	server := serveFixture(t, "rss_boot_dev.xml", "application/rss+xml")
+	s, store := newTestState(t)
+	ctx := context.Background()
+	user := createTestUser(t, s, "test_user")
+	if err := s.cfgManager.SetUser(s.cfg, user.Name); err != nil {
+		t.Fatalf("failed to set user: %v", err)
+	}
+	feed := createTestFeed(t, s, user, "Boot.dev Blog", server.URL)
+	if _, err := store.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:     uuid.New(),
+		UserID: user.ID,
+		FeedID: feed.ID,
+	}); err != nil {
+		t.Fatalf("failed to follow feed: %v", err)
+	}
+
+	t.Run("Browse before scraping", func(t *testing.T) {
+		out, err := captureStdout(t, func() error {
+			return handlerBrowse(ctx, s, command{name: "browse"}, user)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if !strings.Contains(out, "No posts to browse") {
+			t.Errorf("Unexpected output: %q", out)
+		}
+	})
+
+	opts := scrapeOptions{
+		batchSize:     10,
+		concurrency:   2,
+		fetchTimeout:  5 * time.Second,
+		leaseDuration: time.Minute,
+		drainTimeout:  time.Second,
+		workerID:      "test",
+		maxFailures:   3,
+		dueBefore:     time.Now(),
+	}
+
+	t.Run("Scrape", func(t *testing.T) {
+		var claimed int
+		_, err := captureStdout(t, func() error {
+			var err error
+			claimed, err = scrapeFeeds(ctx, s, opts)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if claimed != 1 {
+			t.Errorf("Expected 1 claimed feed but got %d", claimed)
+		}
+		fetched, err := store.GetFeedByURL(ctx, feed.Url)
+		if err != nil {
+			t.Fatalf("failed to get feed: %v", err)
+		}
+		if !fetched.LastFetchedAt.Valid || fetched.LeaseOwner.Valid {
+			t.Errorf("Expected the feed to be fetched and released but got %+v", fetched)
+		}
+	})
+
+	t.Run("Scrape again", func(t *testing.T) {
+		claimed, err := scrapeFeeds(ctx, s, opts)
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if claimed != 0 {
+			t.Errorf("Expected a fetched feed not to be due again but %d were claimed", claimed)
+		}
+	})
+
+	t.Run("Browse", func(t *testing.T) {
+		out, err := captureStdout(t, func() error {
+			return handlerBrowse(ctx, s, command{name: "browse", args: []string{"10"}}, user)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if n := strings.Count(out, "Feed: Boot.dev Blog"); n != 2 {
+			t.Errorf("Expected 2 posts but got %d in: %q", n, out)
+		}
+	})
+
+	t.Run("Browse unread", func(t *testing.T) {
+		posts, err := store.GetPostForUser(ctx, database.GetPostForUserParams{UserID: user.ID, Limit: 10})
+		if err != nil {
+			t.Fatalf("failed to get posts: %v", err)
+		}
+		if err := store.MarkPostRead(ctx, database.MarkPostReadParams{UserID: user.ID, PostID: posts[0].ID}); err != nil {
+			t.Fatalf("failed to mark post read: %v", err)
+		}
+		out, err := captureStdout(t, func() error {
+			return handlerBrowse(ctx, s, command{name: "browse", args: []string{"--unread", "10"}}, user)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if strings.Contains(out, posts[0].Url) || !strings.Contains(out, posts[1].Url) {
+			t.Errorf("Expected only the unread post but got: %q", out)
+		}
+	})
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"36h", now.Add(-36 * time.Hour)},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"1h30m", now.Add(-90 * time.Minute)},
+		{"0s", now},
+		{"7d", time.Date(2025, 3, 3, 12, 0, 0, 0, time.UTC)},
+		{"0d", now},
+		{"2025-01-31", time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"2025-01-31T08:00:00+01:00", time.Date(2025, 1, 31, 7, 0, 0, 0, time.UTC)},
+		{"Fri, 31 Jan 2025 08:00:00 GMT", time.Date(2025, 1, 31, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSince(tt.input, now)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("Expected %v but got %v", tt.expected, got)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "d", "7", "7x", "1.5d", "-7d", "-2h", "last week", "2025-13-01"} {
+		t.Run("invalid "+input, func(t *testing.T) {
+			_, err := parseSince(input, now)
+			if err == nil || !strings.Contains(err.Error(), "could not understand --since") {
+				t.Errorf("Expected an error for %q but got: %v", input, err)
+			}
+		})
+	}
+}
+
+func TestHandlerSave(t *testing.T) {
+	s, store := newTestState(t)
+	ctx := context.Background()
+	user := createTestUser(t, s, "test_user")
+	feed := createTestFeed(t, s, user, "Boot.dev Blog", "https://blog.boot.dev/index.xml")
+	post, err := store.UpsertPost(ctx, database.UpsertPostParams{
+		ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Title: "A post",
+		Url: "https://blog.boot.dev/a-post", PublishedAt: time.Now(), FeedID: feed.ID, Guid: "a-post",
+	})
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	save := func(args ...string) {
+		t.Helper()
+		if _, err := captureStdout(t, func() error {
+			return handlerSave(ctx, s, command{name: "save", args: append([]string{post.ID.String()}, args...)}, user)
+		}); err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+	}
+	note := func() string {
+		t.Helper()
+		saved, err := store.GetSavedPostsForUser(ctx, database.GetSavedPostsForUserParams{UserID: user.ID})
+		if err != nil || len(saved) != 1 {
+			t.Fatalf("Expected one saved post but got %+v, %v", saved, err)
+		}
+		return saved[0].Note.String
+	}
+
+	save("read", "this", "later")
+	if got := note(); got != "read this later" {
+		t.Errorf("Expected the note to be saved but got %q", got)
+	}
+	save()
+	if got := note(); got != "read this later" {
+		t.Errorf("Expected saving again without a note to keep it but got %q", got)
+	}
+	save("changed")
+	if got := note(); got != "changed" {
+		t.Errorf("Expected a new note to replace the old one but got %q", got)
+	}
+}
+
+func TestHandlerAddFeed(t *testing.T) {
+	s, store := newTestState(t)
+	ctx := context.Background()
+	user := createTestUser(t, s, "test_user")
+	runAddFeed := func(args ...string) (string, error) {
+		return captureStdout(t, func() error {
+			return handlerAddFeed(ctx, s, command{name: "addfeed", args: args}, user)
+		})
+	}
+	feedCount := func() int {
+		t.Helper()
+		feeds, err := store.GetFeeds(ctx)
+		if err != nil {
+			t.Fatalf("failed to get feeds: %v", err)
+		}
+		return len(feeds)
+	}
+
+	t.Run("Unreachable URL", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		_, err := runAddFeed("Gone", server.URL)
+		if err == nil || !strings.Contains(err.Error(), "failed to find a feed") {
+			t.Errorf("Expected an error for an unreachable URL but got: %v", err)
+		}
+		if n := feedCount(); n != 0 {
+			t.Errorf("Expected no feed to be created but got %d", n)
+		}
+	})
+
+	t.Run("Not a feed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("just some text"))
+		}))
+		defer server.Close()
+		_, err := runAddFeed("Text", server.URL)
+		if err == nil || !strings.Contains(err.Error(), "is not a valid feed") {
+			t.Errorf("Expected an error for a URL that does not serve a feed but got: %v", err)
+		}
+		if n := feedCount(); n != 0 {
+			t.Errorf("Expected no feed to be created but got %d", n)
+		}
+	})
+
+	t.Run("Name from the feed title", func(t *testing.T) {
+		server := serveFixture(t, "rss_boot_dev.xml", "application/rss+xml")
+		out, err := runAddFeed(server.URL)
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if !strings.Contains(out, "Using the feed's title as its name: Boot.dev Blog") {
+			t.Errorf("Unexpected output: %q", out)
+		}
+		feed, err := store.GetFeedByURL(ctx, server.URL)
+		if err != nil || feed.Name != "Boot.dev Blog" {
+			t.Errorf("Expected the feed to be named after its title but got %+v, %v", feed, err)
+		}
+		follows, err := store.GetFeedFollowsForUser(ctx, user.ID)
+		if err != nil || len(follows) != 1 {
+			t.Errorf("Expected the new feed to be followed but got %+v, %v", follows, err)
+		}
+	})
+
+	t.Run("No verify without a name", func(t *testing.T) {
+		_, err := runAddFeed("https://example.com/feed", "--no-verify")
+		if err == nil || !strings.Contains(err.Error(), "name is required") {
+			t.Errorf("Expected a missing name error but got: %v", err)
+		}
+		if _, err := store.GetFeedByURL(ctx, "https://example.com/feed"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected no feed to be created but got: %v", err)
+		}
+	})
+}
+
+func TestHandlerSavedSearch(t *testing.T) {
+	s, store := newTestState(t)
+	ctx := context.Background()
+	user := createTestUser(t, s, "test_user")
+	feed := createTestFeed(t, s, user, "Boot.dev Blog", "https://blog.boot.dev/index.xml")
+	for _, title := range []string{"Done", "Almost"} {
+		post, err := store.UpsertPost(ctx, database.UpsertPostParams{
+			ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Title: title,
+			Url: "https://blog.boot.dev/" + title, PublishedAt: time.Now(), FeedID: feed.ID, Guid: title,
+		})
+		if err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+		note := map[string]string{"Done": "100% finished", "Almost": "1000 finished"}[title]
+		if _, err := captureStdout(t, func() error {
+			return handlerSave(ctx, s, command{name: "save", args: []string{post.ID.String(), note}}, user)
+		}); err != nil {
+			t.Fatalf("failed to save post: %v", err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"100%", []string{"Done"}},
+		{"100", []string{"Done", "Almost"}},
+		{"1_0", nil},
+	}
+	for _, tt := range tests {
+		out, err := captureStdout(t, func() error {
+			return handlerSaved(ctx, s, command{name: "saved", args: []string{"--search", tt.search}}, user)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		for _, title := range []string{"Done", "Almost"} {
+			if got, want := strings.Contains(out, title), slices.Contains(tt.want, title); got != want {
+				t.Errorf("--search %q: expected %s listed to be %v but got:\n%s", tt.search, title, want, out)
+			}
+		}
+	}
+}
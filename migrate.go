@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+
+	"github.com/Kam1217/blog_aggregator/internal/migrate"
+)
+
+//go:embed sql/schema/*.sql sql/sqlite/schema/*.sql
+var embeddedSchema embed.FS
+
+// schemaMigrations returns the migrations for dialect, as built into the
+// binary: sql/schema for Postgres and sql/sqlite/schema for SQLite.
+func schemaMigrations(dialect migrate.Dialect) fs.FS {
+	dir := "sql/schema"
+	if dialect == migrate.SQLite {
+		dir = "sql/sqlite/schema"
+	}
+	migrations, err := fs.Sub(embeddedSchema, dir)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+func handlerMigrate(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+	switch cmd.args[0] {
+	case "up":
+		applied, err := s.migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("Applied %s\n", migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Printf("The database is up to date at version %d\n", s.migrator.Latest())
+		}
+	case "down":
+		migration, ok, err := s.migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("There are no migrations to roll back")
+			return nil
+		}
+		fmt.Printf("Rolled back %s\n", migration.Name)
+	case "status":
+		statuses, err := s.migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			switch {
+			case status.AppliedAt.Valid:
+				fmt.Printf("%-45s applied %s\n", status.Name, status.AppliedAt.Time.Format("2006-01-02 15:04:05"))
+			case status.Applied:
+				fmt.Printf("%-45s applied\n", status.Name)
+			default:
+				fmt.Printf("%-45s pending\n", status.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down or status", cmd.args[0])
+	}
+	return nil
+}
+
+// checkSchemaVersion refuses to go on when the database is behind the
+// migrations the binary was built with, since the queries in
+// internal/database or internal/sqlitedb would fail against it in confusing
+// ways.
+func checkSchemaVersion(ctx context.Context, migrator *migrate.Migrator) error {
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check the database schema: %w", err)
+	}
+	if latest := migrator.Latest(); version < latest {
+		return fmt.Errorf("the database schema is at version %d but gator needs version %d, run: gator migrate up", version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Kam1217/blog_aggregator/internal/migrate"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := migrate.New(nil, migrate.Postgres, schemaMigrations(migrate.Postgres))
+	if err != nil {
+		t.Fatalf("failed to load the embedded migrations: %v", err)
+	}
+	if migrator.Latest() < 14 {
+		t.Errorf("expected every migration in sql/schema to be embedded, latest is %d", migrator.Latest())
+	}
+	if _, err := migrate.New(nil, migrate.SQLite, schemaMigrations(migrate.SQLite)); err != nil {
+		t.Fatalf("failed to load the embedded SQLite migrations: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OPML is an OPML 2.0 subscription list (http://opml.org/spec2.opml).
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []OPMLOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// OPMLOutline is either a subscription, when XMLURL is set, or a folder of
+// further outlines.
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// opmlSubscription is a feed found in an OPML file. Category is the path of
+// the folders it was nested in, as joinCategory writes it.
+type opmlSubscription struct {
+	Name     string
+	URL      string
+	Category string
+}
+
+// joinCategory joins a path of folder names into a category with "/". A "/"
+// or "\" within a name is escaped with a backslash, so a folder named
+// "News/Politics" is not read back as two nested folders.
+func joinCategory(folders []string) string {
+	escaped := make([]string, len(folders))
+	for i, name := range folders {
+		escaped[i] = categoryEscaper.Replace(name)
+	}
+	return strings.Join(escaped, "/")
+}
+
+var categoryEscaper = strings.NewReplacer(`\`, `\\`, "/", `\/`)
+
+// splitCategory returns the folder names of a category joinCategory wrote.
+func splitCategory(category string) []string {
+	var folders []string
+	var name strings.Builder
+	escaped := false
+	for _, r := range category {
+		switch {
+		case escaped:
+			name.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '/':
+			folders = append(folders, name.String())
+			name.Reset()
+		default:
+			name.WriteRune(r)
+		}
+	}
+	return append(folders, name.String())
+}
+
+func parseOPML(r io.Reader) ([]opmlSubscription, error) {
+	var doc OPML
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charsetReader
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OPML: %w", err)
+	}
+	var subs []opmlSubscription
+	var walk func(outlines []OPMLOutline, folders []string)
+	walk = func(outlines []OPMLOutline, folders []string) {
+		for _, outline := range outlines {
+			name := strings.TrimSpace(outline.Title)
+			if name == "" {
+				name = strings.TrimSpace(outline.Text)
+			}
+			if outline.XMLURL != "" {
+				if name == "" {
+					name = outline.XMLURL
+				}
+				subs = append(subs, opmlSubscription{
+					Name:     name,
+					URL:      strings.TrimSpace(outline.XMLURL),
+					Category: joinCategory(folders),
+				})
+				continue
+			}
+			walk(outline.Outlines, append(folders[:len(folders):len(folders)], name))
+		}
+	}
+	walk(doc.Body.Outlines, nil)
+	return subs, nil
+}
+
+// writeOPML writes subs as an OPML 2.0 document, nesting subscriptions in
+// folder outlines by category.
+func writeOPML(w io.Writer, title, dateCreated string, subs []opmlSubscription) error {
+	doc := OPML{Version: "2.0"}
+	doc.Head.Title = title
+	doc.Head.DateCreated = dateCreated
+
+	root := &opmlFolder{}
+	for _, sub := range subs {
+		folder := root
+		if sub.Category != "" {
+			for _, name := range splitCategory(sub.Category) {
+				folder = folder.child(name)
+			}
+		}
+		folder.outlines = append(folder.outlines, OPMLOutline{
+			Text:   sub.Name,
+			Title:  sub.Name,
+			Type:   "rss",
+			XMLURL: sub.URL,
+		})
+	}
+	doc.Body.Outlines = root.toOutlines()
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write OPML: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// opmlFolder collects the outlines of one category while an export is built,
+// keeping folders in the order they were first seen.
+type opmlFolder struct {
+	name     string
+	outlines []OPMLOutline
+	children []*opmlFolder
+}
+
+func (f *opmlFolder) child(name string) *opmlFolder {
+	for _, c := range f.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &opmlFolder{name: name}
+	f.children = append(f.children, c)
+	return c
+}
+
+func (f *opmlFolder) toOutlines() []OPMLOutline {
+	outlines := f.outlines
+	for _, c := range f.children {
+		outlines = append(outlines, OPMLOutline{
+			Text:     c.name,
+			Title:    c.name,
+			Outlines: c.toOutlines(),
+		})
+	}
+	return outlines
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/Kam1217/blog_aggregator/internal/memstore"
+)
+
+const testOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Boot.dev" type="rss" xmlUrl="https://blog.boot.dev/index.xml"/>
+    <outline text="Tech">
+      <outline title="Go Blog" text="The Go Blog" type="rss" xmlUrl=" https://go.dev/blog/feed.atom "/>
+      <outline text="Languages">
+        <outline text="Rust" type="rss" xmlUrl="https://blog.rust-lang.org/feed.xml"/>
+      </outline>
+      <outline text="Empty folder"/>
+    </outline>
+    <outline text="News/Politics">
+      <outline type="rss" xmlUrl="https://example.com/politics.rss"/>
+    </outline>
+    <outline text="A link, not a feed" type="link" url="https://example.com/"/>
+  </body>
+</opml>`
+
+func TestParseOPML(t *testing.T) {
+	subs, err := parseOPML(strings.NewReader(testOPML))
+	if err != nil {
+		t.Fatalf("failed to parse OPML: %v", err)
+	}
+	want := []opmlSubscription{
+		{Name: "Boot.dev", URL: "https://blog.boot.dev/index.xml"},
+		{Name: "Go Blog", URL: "https://go.dev/blog/feed.atom", Category: "Tech"},
+		{Name: "Rust", URL: "https://blog.rust-lang.org/feed.xml", Category: "Tech/Languages"},
+		{Name: "https://example.com/politics.rss", URL: "https://example.com/politics.rss", Category: `News\/Politics`},
+	}
+	if !reflect.DeepEqual(subs, want) {
+		t.Errorf("expected %+v but got %+v", want, subs)
+	}
+
+	if _, err := parseOPML(strings.NewReader("<opml><body>")); err == nil {
+		t.Error("expected an error for a truncated document")
+	}
+}
+
+func TestParseOPMLCharset(t *testing.T) {
+	doc := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		"<opml version=\"1.0\"><body><outline text=\"Caf\xe9\">" +
+		"<outline text=\"L'\xe9quipe\" xmlUrl=\"https://example.com/feed\"/>" +
+		"</outline></body></opml>"
+	subs, err := parseOPML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to parse OPML: %v", err)
+	}
+	if len(subs) != 1 || subs[0].Name != "L'équipe" || subs[0].Category != "Café" {
+		t.Errorf("expected the names to be decoded from ISO-8859-1 but got %+v", subs)
+	}
+}
+
+func TestWriteOPMLRoundTrip(t *testing.T) {
+	subs, err := parseOPML(strings.NewReader(testOPML))
+	if err != nil {
+		t.Fatalf("failed to parse OPML: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writeOPML(&buf, "Subscriptions", "Mon, 02 Jan 2006 15:04:05 -0700", subs); err != nil {
+		t.Fatalf("failed to write OPML: %v", err)
+	}
+	if !strings.Contains(buf.String(), `<outline text="News/Politics" title="News/Politics">`) {
+		t.Errorf("expected the folder name to be written unescaped but got:\n%s", buf.String())
+	}
+	again, err := parseOPML(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse the written OPML: %v", err)
+	}
+	if !reflect.DeepEqual(again, subs) {
+		t.Errorf("expected %+v after a round trip but got %+v", subs, again)
+	}
+}
+
+func TestCategoryPath(t *testing.T) {
+	tests := []struct {
+		folders  []string
+		category string
+	}{
+		{[]string{"Tech"}, "Tech"},
+		{[]string{"Tech", "Go"}, "Tech/Go"},
+		{[]string{"News/Politics", "EU"}, `News\/Politics/EU`},
+		{[]string{`C:\feeds`}, `C:\\feeds`},
+	}
+	for _, tt := range tests {
+		if got := joinCategory(tt.folders); got != tt.category {
+			t.Errorf("joinCategory(%q) = %q, want %q", tt.folders, got, tt.category)
+		}
+		if got := splitCategory(tt.category); !reflect.DeepEqual(got, tt.folders) {
+			t.Errorf("splitCategory(%q) = %q, want %q", tt.category, got, tt.folders)
+		}
+	}
+}
+
+func TestHandlerImportOPML(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	other := createTestUser(t, s, "bob")
+	createTestFeed(t, s, other, "Go Blog", "https://go.dev/blog/feed.atom")
+	path := filepath.Join(t.TempDir(), "subscriptions.opml")
+	if err := os.WriteFile(path, []byte(testOPML), 0644); err != nil {
+		t.Fatalf("failed to write OPML: %v", err)
+	}
+	cmd := command{name: "import-opml", args: []string{path}}
+
+	out, err := captureStdout(t, func() error { return handlerImportOPML(ctx, s, cmd, user) })
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if !strings.Contains(out, "Imported 4 feeds: 3 created, 1 already existed, 0 already followed, 0 failed") {
+		t.Errorf("unexpected summary: %q", out)
+	}
+	out, err = captureStdout(t, func() error { return handlerImportOPML(ctx, s, cmd, user) })
+	if err != nil {
+		t.Fatalf("failed to import again: %v", err)
+	}
+	if !strings.Contains(out, "Imported 4 feeds: 0 created, 0 already existed, 4 already followed, 0 failed") {
+		t.Errorf("unexpected summary: %q", out)
+	}
+
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to get follows: %v", err)
+	}
+	categories := map[string]string{}
+	for _, follow := range follows {
+		categories[follow.FeedUrl] = follow.Category.String
+	}
+	if got := categories["https://blog.rust-lang.org/feed.xml"]; got != "Tech/Languages" {
+		t.Errorf("expected the nested folders as category but got %q", got)
+	}
+}
+
+func TestUniqueFeedName(t *testing.T) {
+	taken := map[string]bool{"Releases": true, "Releases (github.com)": true, "Releases (2)": true}
+	tests := []struct {
+		name, url, want string
+	}{
+		{"Go Blog", "https://go.dev/blog/feed.atom", "Go Blog"},
+		{"Releases", "https://gitlab.com/releases.atom", "Releases (gitlab.com)"},
+		{"Releases", "https://github.com/golang/go/releases.atom", "Releases (3)"},
+	}
+	for _, tt := range tests {
+		if got := uniqueFeedName(tt.name, tt.url, taken); got != tt.want {
+			t.Errorf("uniqueFeedName(%q, %q) = %q, want %q", tt.name, tt.url, got, tt.want)
+		}
+	}
+}
+
+// failingFollows is a store whose CreateFeedFollow fails after the first ok
+// calls.
+type failingFollows struct {
+	*memstore.Store
+	ok int
+}
+
+func (s *failingFollows) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	if s.ok == 0 {
+		return database.CreateFeedFollowRow{}, errors.New("connection reset")
+	}
+	s.ok--
+	return s.Store.CreateFeedFollow(ctx, arg)
+}
+
+func TestHandlerImportOPMLDuplicates(t *testing.T) {
+	const doc = `<opml version="2.0"><body>
+  <outline text="Go"><outline text="Releases" xmlUrl="https://github.com/golang/go/releases.atom"/></outline>
+  <outline text="Rust"><outline text="Releases" xmlUrl="https://github.com/rust-lang/rust/releases.atom"/></outline>
+  <outline text="Zig"><outline text="Releases" xmlUrl="https://github.com/ziglang/zig/releases.atom"/></outline>
+</body></opml>`
+	ctx := context.Background()
+	s, store := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	path := filepath.Join(t.TempDir(), "subscriptions.opml")
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("failed to write OPML: %v", err)
+	}
+	cmd := command{name: "import-opml", args: []string{path}}
+
+	t.Run("failed follow", func(t *testing.T) {
+		s.db = &failingFollows{Store: store, ok: 1}
+		defer func() { s.db = store }()
+		out, err := captureStdout(t, func() error { return handlerImportOPML(ctx, s, cmd, user) })
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		if !strings.Contains(out, "Imported 3 feeds: 1 created, 0 already existed, 0 already followed, 2 failed") {
+			t.Errorf("unexpected summary: %q", out)
+		}
+		feeds, err := store.GetFeeds(ctx)
+		if err != nil || len(feeds) != 1 {
+			t.Errorf("expected only the followed feed to be kept but got %+v, %v", feeds, err)
+		}
+	})
+
+	t.Run("same title", func(t *testing.T) {
+		out, err := captureStdout(t, func() error { return handlerImportOPML(ctx, s, cmd, user) })
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		if !strings.Contains(out, "Imported 3 feeds: 2 created, 0 already existed, 1 already followed, 0 failed") {
+			t.Errorf("unexpected summary: %q", out)
+		}
+		var names []string
+		for _, url := range []string{
+			"https://github.com/golang/go/releases.atom",
+			"https://github.com/rust-lang/rust/releases.atom",
+			"https://github.com/ziglang/zig/releases.atom",
+		} {
+			feed, err := store.GetFeedByURL(ctx, url)
+			if err != nil {
+				t.Fatalf("failed to get feed %s: %v", url, err)
+			}
+			names = append(names, feed.Name)
+		}
+		want := []string{"Releases", "Releases (github.com)", "Releases (2)"}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("expected the names %q but got %q", want, names)
+		}
+	})
+}
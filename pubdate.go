@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// pubDateLayouts are tried in order by parsePubDate. They cover RFC 822/1123
+// dates with and without seconds, weekdays, numeric or named zones and
+// two-digit years, plus the ISO 8601 forms used by Atom, JSON Feed and dc:date.
+var pubDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 -07:00",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04:05 MST",
+	"Mon, 2 Jan 06 15:04 -0700",
+	"Mon, 2 Jan 06 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 January 2006 15:04:05 -0700",
+	"Mon, 2 January 2006 15:04:05 MST",
+	time.RFC850,
+	time.ANSIC,
+	time.UnixDate,
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// zoneOffsets fixes up the North American zone names that still show up in
+// feeds. time.Parse only knows the offset of UTC, GMT and the local zone and
+// treats any other abbreviation as +0000.
+var zoneOffsets = map[string]int{
+	"EST": -5 * 60 * 60,
+	"EDT": -4 * 60 * 60,
+	"CST": -6 * 60 * 60,
+	"CDT": -5 * 60 * 60,
+	"MST": -7 * 60 * 60,
+	"MDT": -6 * 60 * 60,
+	"PST": -8 * 60 * 60,
+	"PDT": -7 * 60 * 60,
+}
+
+var (
+	spaceRun      = regexp.MustCompile(`\s+`)
+	zoneComment   = regexp.MustCompile(`\s*\([^)]*\)$`)
+	universalTime = regexp.MustCompile(` UT$`)
+	errNoPubDate  = errors.New("no publication date")
+	errBadPubDate = errors.New("unrecognised publication date format")
+)
+
+// parsePubDate parses a publication date as found in the wild.
+func parsePubDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(spaceRun.ReplaceAllString(value, " "))
+	value = zoneComment.ReplaceAllString(value, "")
+	value = universalTime.ReplaceAllString(value, " +0000")
+	if value == "" {
+		return time.Time{}, errNoPubDate
+	}
+
+	for _, layout := range pubDateLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		name, offset := t.Zone()
+		if fixed, ok := zoneOffsets[name]; ok && offset != fixed {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone(name, fixed))
+		}
+		return t, nil
+	}
+	return time.Time{}, errBadPubDate
+}
+
+// resolvePubDate returns the publication date of an item. When the item has
+// no usable date it falls back to the feed's last build date and then to the
+// fetch time, and reports that the date was synthesized.
+func resolvePubDate(pubDate, lastBuildDate string, fetchedAt time.Time) (time.Time, bool) {
+	if t, err := parsePubDate(pubDate); err == nil {
+		return t, false
+	}
+	if t, err := parsePubDate(lastBuildDate); err == nil {
+		return t, true
+	}
+	return fetchedAt, true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"Wed, 01 May 2024 10:30:00 +0000", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"Wed, 01 May 2024 10:30:00 GMT", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"Wed, 1 May 2024 10:30:00 +0200", time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)},
+		{"Wed, 01 May 2024 10:30 +0000", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"Wed, 01 May 24 10:30:00 +0000", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"01 May 2024 10:30:00 +0000", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"Wed, 01 May 2024 06:30:00 EDT", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"Wed, 01 May 2024 10:30:00 UT", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"Wed, 01 May 2024 10:30:00 +0000 (UTC)", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"  Wed,  01 May 2024\n 10:30:00 +0000 ", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"2024-05-01T10:30:00Z", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"2024-05-01T12:30:00.123+02:00", time.Date(2024, 5, 1, 10, 30, 0, 123000000, time.UTC)},
+		{"2024-05-01 10:30:00", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parsePubDate(tt.input)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", tt.input, err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("expected %v but got %v", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("Unparsable date", func(t *testing.T) {
+		if _, err := parsePubDate("last tuesday"); err == nil {
+			t.Errorf("expected error for unparsable date")
+		}
+	})
+}
+
+func TestResolvePubDate(t *testing.T) {
+	fetchedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Item date", func(t *testing.T) {
+		got, synthesized := resolvePubDate("Wed, 01 May 2024 10:30:00 +0000", "Thu, 02 May 2024 00:00:00 +0000", fetchedAt)
+		if synthesized || !got.Equal(time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)) {
+			t.Errorf("expected the item date but got %v (synthesized %v)", got, synthesized)
+		}
+	})
+
+	t.Run("Falls back to lastBuildDate", func(t *testing.T) {
+		got, synthesized := resolvePubDate("", "Thu, 02 May 2024 00:00:00 +0000", fetchedAt)
+		if !synthesized || !got.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected the lastBuildDate but got %v (synthesized %v)", got, synthesized)
+		}
+	})
+
+	t.Run("Falls back to fetch time", func(t *testing.T) {
+		got, synthesized := resolvePubDate("garbage", "", fetchedAt)
+		if !synthesized || !got.Equal(fetchedAt) {
+			t.Errorf("expected the fetch time but got %v (synthesized %v)", got, synthesized)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import "strings"
+
+const (
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	dcNamespace  = "http://purl.org/dc/elements/1.1/"
+)
+
+// RDFFeed is an RSS 1.0 document. Unlike RSS 2.0 the items are siblings of
+// the channel under the rdf:RDF root, and dates are Dublin Core dc:date.
+type RDFFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	} `xml:"channel"`
+	Items []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+}
+
+func (f *RDFFeed) toRSS() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = strings.TrimSpace(f.Channel.Title)
+	feed.Channel.Link = strings.TrimSpace(f.Channel.Link)
+	feed.Channel.Description = strings.TrimSpace(f.Channel.Description)
+	feed.Channel.LastBuildDate = normalizeDate(strings.TrimSpace(f.Channel.Date))
+
+	for _, item := range f.Items {
+		link := strings.TrimSpace(item.Link)
+		guid := strings.TrimSpace(item.About)
+		if guid == "" {
+			guid = link
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       strings.TrimSpace(item.Title),
+			Link:        link,
+			Description: strings.TrimSpace(item.Description),
+			PubDate:     normalizeDate(strings.TrimSpace(item.Date)),
+			GUID:        guid,
+			Author:      strings.TrimSpace(item.Creator),
+		})
+	}
+	return &feed
+}
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
 	"io"
+	"mime"
 	"net/http"
+	"time"
 )
 
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		LastBuildDate string    `xml:"lastBuildDate"`
+		Item          []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
@@ -23,31 +29,97 @@ type RSSItem struct {
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+	Author      string `xml:"author"`
 }
 
+// fetchResult is the outcome of a conditional feed fetch. When the server
+// answers 304 Not Modified, NotModified is set and Feed is nil. RedirectURL is
+// set when the feed was reached through permanent (301/308) redirects only.
+type fetchResult struct {
+	Feed         *RSSFeed
+	StatusCode   int
+	NotModified  bool
+	ETag         string
+	LastModified string
+	RedirectURL  string
+}
+
+// maxRedirects matches the limit of http.Client's default redirect policy.
+const maxRedirects = 10
+
 func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
+	result, err := fetchFeedConditional(ctx, feedURL, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return result.Feed, nil
+}
+
+// fetchFeedConditional fetches a feed, sending If-None-Match and
+// If-Modified-Since when validators from a previous fetch are given. Once a
+// response has arrived the result is returned even on error so callers can
+// see the HTTP status.
+func fetchFeedConditional(ctx context.Context, feedURL, etag, lastModified string) (*fetchResult, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get the new request: %w", err)
 	}
 	req.Header.Set("User-Agent", "gator")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
 
-	client := &http.Client{}
+	redirected, permanent := false, true
+	client := newFetchClient(func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		redirected = true
+		status := req.Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			permanent = false
+		}
+		return nil
+	})
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	result := &fetchResult{
+		StatusCode:   resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if redirected && permanent {
+		result.RedirectURL = resp.Request.URL.String()
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, fmt.Errorf("server returned HTTP %s", resp.Status)
+	}
+
+	data, err := readBody(resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed ot read the response: %w", err)
+		return result, fmt.Errorf("failed ot read the response: %w", err)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if err := checkFeedContentType(contentType, data); err != nil {
+		return result, err
 	}
 
-	var feed RSSFeed
-	err = xml.Unmarshal(data, &feed)
+	feed, err := parseFeed(contentType, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal the data: %w", err)
+		return result, err
 	}
 
 	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
@@ -57,5 +129,103 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 		feed.Channel.Item[i].Title = html.UnescapeString(item.Title)
 		feed.Channel.Item[i].Description = html.UnescapeString(item.Description)
 	}
-	return &feed, nil
+	result.Feed = feed
+	return result, nil
+}
+
+// parseFeed decodes JSON Feed documents (by Content-Type or a leading '{')
+// and otherwise looks at the XML root element to pick the matching format,
+// returning the items in the RSS shape scrapeFeeds expects.
+func parseFeed(contentType string, data []byte) (*RSSFeed, error) {
+	if isJSONFeed(contentType, data) {
+		var feed JSONFeed
+		if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\ufeff")), &feed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the json feed: %w", err)
+		}
+		return feed.toRSS(), nil
+	}
+
+	data, err := prepareXML(contentType, data)
+	if err != nil {
+		return nil, err
+	}
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the data: %w", err)
+	}
+
+	switch root.Local {
+	case "feed":
+		var feed AtomFeed
+		if err := unmarshalXML(data, &feed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the atom data: %w", err)
+		}
+		return feed.toRSS(), nil
+	case "RDF":
+		var feed RDFFeed
+		if err := unmarshalXML(data, &feed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the rdf data: %w", err)
+		}
+		return feed.toRSS(), nil
+	default:
+		var feed RSSFeed
+		if err := unmarshalXML(data, &feed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the data: %w", err)
+		}
+		return &feed, nil
+	}
+}
+
+func isJSONFeed(contentType string, data []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/feed+json", "application/json":
+		return true
+	}
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func rootElement(data []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charsetReader
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return xml.Name{}, errors.New("document has no root element")
+			}
+			return xml.Name{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// unmarshalXML is xml.Unmarshal with charsetReader for documents that
+// declare a non-UTF-8 encoding.
+func unmarshalXML(data []byte, v any) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charsetReader
+	return decoder.Decode(v)
+}
+
+// isoDateLayouts are the W3C-DTF profiles of ISO 8601 used by Atom, JSON Feed
+// and Dublin Core dc:date.
+var isoDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+// normalizeDate rewrites ISO 8601 timestamps into the RFC 1123Z form RSS uses
+// for pubDate. Anything it can't parse is returned unchanged.
+func normalizeDate(value string) string {
+	for _, layout := range isoDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(time.RFC1123Z)
+		}
+	}
+	return value
 }
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveFixture(t *testing.T, name, contentType string) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchFeedRSS(t *testing.T) {
+	server := serveFixture(t, "rss_boot_dev.xml", "application/rss+xml")
+
+	feed, err := fetchFeed(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("failed to fetch feed: %v", err)
+	}
+	if feed.Channel.Title != "Boot.dev Blog" {
+		t.Errorf("expected title 'Boot.dev Blog' but got: %s", feed.Channel.Title)
+	}
+	if len(feed.Channel.Item) != 2 {
+		t.Fatalf("expected 2 items but got %d", len(feed.Channel.Item))
+	}
+	item := feed.Channel.Item[0]
+	if item.Description != "A new course on Docker & Kubernetes is now live." {
+		t.Errorf("expected unescaped description but got: %s", item.Description)
+	}
+	if item.GUID != "https://blog.boot.dev/news/bootdev-beat-2024-05/" {
+		t.Errorf("unexpected guid: %s", item.GUID)
+	}
+}
+
+func TestFetchFeedAtom(t *testing.T) {
+	t.Run("GitHub releases", func(t *testing.T) {
+		server := serveFixture(t, "atom_github_releases.xml", "application/atom+xml; charset=utf-8")
+
+		feed, err := fetchFeed(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		if feed.Channel.Title != "Release notes from go" {
+			t.Errorf("expected title 'Release notes from go' but got: %s", feed.Channel.Title)
+		}
+		if feed.Channel.Link != "https://github.com/golang/go/releases" {
+			t.Errorf("expected alternate link but got: %s", feed.Channel.Link)
+		}
+		if len(feed.Channel.Item) != 2 {
+			t.Fatalf("expected 2 items but got %d", len(feed.Channel.Item))
+		}
+		item := feed.Channel.Item[0]
+		if item.Title != "go1.24.6" {
+			t.Errorf("expected title 'go1.24.6' but got: %s", item.Title)
+		}
+		if item.Link != "https://github.com/golang/go/releases/tag/go1.24.6" {
+			t.Errorf("unexpected link: %s", item.Link)
+		}
+		if item.Description != "<p>Security fixes to the <code>database/sql</code> and <code>os/exec</code> packages.</p>" {
+			t.Errorf("expected content as description but got: %s", item.Description)
+		}
+		if item.PubDate != "Wed, 06 Aug 2025 17:02:11 +0000" {
+			t.Errorf("expected updated date as pubDate but got: %s", item.PubDate)
+		}
+		if item.GUID != "tag:github.com,2008:Repository/23096959/go1.24.6" {
+			t.Errorf("unexpected guid: %s", item.GUID)
+		}
+	})
+
+	t.Run("Blogger", func(t *testing.T) {
+		server := serveFixture(t, "atom_blogger.xml", "application/atom+xml; charset=UTF-8")
+
+		feed, err := fetchFeed(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		if feed.Channel.Description != "Updates on changes & additions to the Google Developers Blog." {
+			t.Errorf("unexpected description: %s", feed.Channel.Description)
+		}
+		if len(feed.Channel.Item) != 2 {
+			t.Fatalf("expected 2 items but got %d", len(feed.Channel.Item))
+		}
+		first := feed.Channel.Item[0]
+		if first.Title != "Announcing Kotlin Multiplatform & Jetpack updates" {
+			t.Errorf("unexpected title: %s", first.Title)
+		}
+		if first.Link != "https://developers.googleblog.com/2024/11/kotlin-multiplatform.html" {
+			t.Errorf("expected the alternate link but got: %s", first.Link)
+		}
+		if first.Description != "Support for sharing business logic across Android and iOS." {
+			t.Errorf("expected summary as description but got: %s", first.Description)
+		}
+		if first.PubDate != "Tue, 19 Nov 2024 09:30:00 -0800" {
+			t.Errorf("expected published date as pubDate but got: %s", first.PubDate)
+		}
+		second := feed.Channel.Item[1]
+		if second.Description != `<div xmlns="http://www.w3.org/1999/xhtml"><p>Structured outputs are now available.</p></div>` {
+			t.Errorf("expected xhtml content as description but got: %s", second.Description)
+		}
+	})
+}
+
+func TestFetchFeedJSON(t *testing.T) {
+	check := func(t *testing.T, feed *RSSFeed) {
+		t.Helper()
+		if feed.Channel.Title != "Manton Reece" {
+			t.Errorf("expected title 'Manton Reece' but got: %s", feed.Channel.Title)
+		}
+		if len(feed.Channel.Item) != 2 {
+			t.Fatalf("expected 2 items but got %d", len(feed.Channel.Item))
+		}
+		first := feed.Channel.Item[0]
+		if first.Link != "https://www.manton.org/2024/06/12/blogging-is-back.html" {
+			t.Errorf("unexpected link: %s", first.Link)
+		}
+		if first.Description != "<p>Everyone is starting a blog again & I love it.</p>" {
+			t.Errorf("expected content_html as description but got: %s", first.Description)
+		}
+		if first.PubDate != "Wed, 12 Jun 2024 09:15:00 -0500" {
+			t.Errorf("unexpected pubDate: %s", first.PubDate)
+		}
+		if first.GUID != "http://manton2.micro.blog/2024/06/12/blogging-is-back.html" {
+			t.Errorf("unexpected guid: %s", first.GUID)
+		}
+		if first.Author != "Manton Reece, Jean MacDonald" {
+			t.Errorf("unexpected author: %s", first.Author)
+		}
+		second := feed.Channel.Item[1]
+		if second.Description != "A short note without a title." {
+			t.Errorf("expected content_text as description but got: %s", second.Description)
+		}
+		if second.Author != "Manton Reece" {
+			t.Errorf("expected the 1.0 author field to be used but got: %s", second.Author)
+		}
+	}
+
+	t.Run("By content type", func(t *testing.T) {
+		server := serveFixture(t, "jsonfeed_indie.json", "application/feed+json")
+		feed, err := fetchFeed(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		check(t, feed)
+	})
+
+	t.Run("Sniffed body", func(t *testing.T) {
+		server := serveFixture(t, "jsonfeed_indie.json", "text/plain")
+		feed, err := fetchFeed(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		check(t, feed)
+	})
+}
+
+func TestFetchFeedRDF(t *testing.T) {
+	t.Run("arXiv", func(t *testing.T) {
+		server := serveFixture(t, "rdf_arxiv.xml", "application/rdf+xml")
+
+		feed, err := fetchFeed(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		if feed.Channel.Title != "cs.DL updates on arXiv.org" {
+			t.Errorf("unexpected title: %s", feed.Channel.Title)
+		}
+		if len(feed.Channel.Item) != 2 {
+			t.Fatalf("expected 2 items but got %d", len(feed.Channel.Item))
+		}
+		first := feed.Channel.Item[0]
+		if first.Link != "http://arxiv.org/abs/2310.16517" {
+			t.Errorf("unexpected link: %s", first.Link)
+		}
+		if first.Description != "<p>We study why authors cite the work of others.</p>" {
+			t.Errorf("unexpected description: %s", first.Description)
+		}
+		if first.PubDate != "Thu, 26 Oct 2023 20:30:00 -0500" {
+			t.Errorf("expected dc:date as pubDate but got: %s", first.PubDate)
+		}
+		if first.GUID != "http://arxiv.org/abs/2310.16517" {
+			t.Errorf("expected rdf:about as guid but got: %s", first.GUID)
+		}
+		second := feed.Channel.Item[1]
+		if second.PubDate != "Wed, 25 Oct 2023 09:00:00 +0000" {
+			t.Errorf("expected dc:date without seconds to be read but got: %s", second.PubDate)
+		}
+	})
+
+	t.Run("Date only", func(t *testing.T) {
+		server := serveFixture(t, "rdf_gov.xml", "text/xml")
+
+		feed, err := fetchFeed(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		if len(feed.Channel.Item) != 1 {
+			t.Fatalf("expected 1 item but got %d", len(feed.Channel.Item))
+		}
+		if feed.Channel.Item[0].PubDate != "Wed, 20 Mar 2024 00:00:00 +0000" {
+			t.Errorf("unexpected pubDate: %s", feed.Channel.Item[0].PubDate)
+		}
+	})
+}
+
+func TestFetchFeedConditional(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "rss_boot_dev.xml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	const etag = `"v1"`
+	const lastModified = "Wed, 01 May 2024 00:00:00 GMT"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	t.Run("First fetch", func(t *testing.T) {
+		result, err := fetchFeedConditional(context.Background(), server.URL, "", "")
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		if result.NotModified || result.Feed == nil {
+			t.Fatalf("expected a full response")
+		}
+		if result.ETag != etag || result.LastModified != lastModified {
+			t.Errorf("expected validators %s / %s but got %s / %s", etag, lastModified, result.ETag, result.LastModified)
+		}
+	})
+
+	t.Run("Matching ETag", func(t *testing.T) {
+		result, err := fetchFeedConditional(context.Background(), server.URL, etag, "")
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		if !result.NotModified {
+			t.Errorf("expected a not modified response")
+		}
+	})
+
+	t.Run("Matching Last-Modified", func(t *testing.T) {
+		result, err := fetchFeedConditional(context.Background(), server.URL, "", lastModified)
+		if err != nil {
+			t.Fatalf("failed to fetch feed: %v", err)
+		}
+		if !result.NotModified {
+			t.Errorf("expected a not modified response")
+		}
+	})
+}
+
+func TestFetchFeedRedirects(t *testing.T) {
+	feed := serveFixture(t, "rss_boot_dev.xml", "application/rss+xml")
+	mux := http.NewServeMux()
+	mux.Handle("/moved", http.RedirectHandler(feed.URL, http.StatusMovedPermanently))
+	mux.Handle("/moved-twice", http.RedirectHandler("/moved", http.StatusPermanentRedirect))
+	mux.Handle("/temporary", http.RedirectHandler("/moved", http.StatusFound))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/moved", feed.URL},
+		{"/moved-twice", feed.URL},
+		{"/temporary", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result, err := fetchFeedConditional(context.Background(), server.URL+tt.path, "", "")
+			if err != nil {
+				t.Fatalf("failed to fetch feed: %v", err)
+			}
+			if result.RedirectURL != tt.want {
+				t.Errorf("expected redirect URL %q but got %q", tt.want, result.RedirectURL)
+			}
+		})
+	}
+
+	result, err := fetchFeedConditional(context.Background(), feed.URL, "", "")
+	if err != nil {
+		t.Fatalf("failed to fetch feed: %v", err)
+	}
+	if result.RedirectURL != "" {
+		t.Errorf("expected no redirect URL but got %q", result.RedirectURL)
+	}
+}
+
+func TestFetchFeedGuards(t *testing.T) {
+	saved := fetchLimits
+	t.Cleanup(func() { setFetchLimits(saved) })
+	limits := saved
+	limits.MaxBodyBytes = 1024
+	limits.ReadTimeout = 100 * time.Millisecond
+	setFetchLimits(limits)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>not here</html>", http.StatusNotFound)
+	})
+	mux.HandleFunc("/logo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	})
+	mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("PK\x03\x04 zipped feeds"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte("<rss><channel><title>" + strings.Repeat("a", 2048) + "</title></channel></rss>"))
+	})
+	mux.HandleFunc("/stalled", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte("<rss><channel>"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		path    string
+		status  int
+		wantErr string
+	}{
+		{"/gone", http.StatusNotFound, "404 Not Found"},
+		{"/logo", http.StatusOK, "image/png"},
+		{"/archive", http.StatusOK, "application/zip"},
+		{"/huge", http.StatusOK, "feed too large"},
+		{"/stalled", http.StatusOK, "no data received"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result, err := fetchFeedConditional(context.Background(), server.URL+tt.path, "", "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error containing %q but got %v", tt.wantErr, err)
+			}
+			if result == nil || result.StatusCode != tt.status {
+				t.Errorf("expected status %d in the result but got %+v", tt.status, result)
+			}
+		})
+	}
+}
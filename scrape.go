@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLeaseDuration = 2 * time.Minute
+	defaultDrainTimeout  = 10 * time.Second
+	// A feed that fails is retried after baseFetchBackoff, doubling with
+	// each further failure up to maxFetchBackoff.
+	baseFetchBackoff = 5 * time.Minute
+	maxFetchBackoff  = 24 * time.Hour
+	// releaseTimeout bounds handing a lease back while shutting down.
+	releaseTimeout = 5 * time.Second
+)
+
+// scrapeOptions controls a single round of scraping.
+type scrapeOptions struct {
+	batchSize     int
+	concurrency   int
+	fetchTimeout  time.Duration
+	leaseDuration time.Duration
+	// drainTimeout is how long in-flight scrapes may keep running after the
+	// context passed to scrapeFeeds is cancelled.
+	drainTimeout time.Duration
+	// workerID identifies this aggregator in feeds.lease_owner so several
+	// aggregators can share the feeds table without fetching the same feed.
+	workerID string
+	// maxFailures is the number of consecutive failed fetches after which a
+	// feed is disabled.
+	maxFailures int
+	// dueBefore limits the round to feeds last fetched before this time.
+	dueBefore time.Time
+}
+
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gator"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+// scrapeFeeds claims the batchSize stalest due feeds and scrapes them with at
+// most concurrency fetches in flight, each limited to fetchTimeout. It returns
+// how many feeds it claimed. Every claimed feed is released through
+// MarkFeedFetched once it is done; a lease left behind by a crashed
+// aggregator expires after leaseDuration.
+//
+// Once ctx is cancelled no further scrapes are started and the ones in flight
+// get drainTimeout to finish before they are cancelled too.
+func scrapeFeeds(ctx context.Context, s *state, opts scrapeOptions) (int, error) {
+	feeds, err := s.db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+		LeaseOwner:   opts.workerID,
+		LeaseSeconds: int32(opts.leaseDuration / time.Second),
+		DueBefore:    opts.dueBefore,
+		BatchSize:    int32(opts.batchSize),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim the next feeds: %w", err)
+	}
+
+	workCtx, cancelWork := drainContext(ctx, opts.drainTimeout)
+	defer cancelWork()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, opts.concurrency)
+	for i, feed := range feeds {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			releaseLeases(s, feeds[i:], opts)
+			break
+		}
+		wg.Add(1)
+		go func(feed database.Feed) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := scrapeClaimedFeed(workCtx, s, feed, opts); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", feed.Name, err))
+				mu.Unlock()
+			}
+		}(feed)
+	}
+	wg.Wait()
+	return len(feeds), errors.Join(errs...)
+}
+
+// scrapeClaimedFeed scrapes a feed this aggregator holds the lease on and
+// records the outcome. If ctx is cancelled underneath it the feed is handed
+// back untouched rather than counted as a failed fetch.
+func scrapeClaimedFeed(ctx context.Context, s *state, feed database.Feed, opts scrapeOptions) error {
+	claimed := &claimedFeed{feed: feed}
+	stopHeartbeat := heartbeatLease(ctx, s, claimed, opts)
+	fetchCtx, cancel := context.WithTimeout(ctx, opts.fetchTimeout)
+	status, err := scrapeFeed(fetchCtx, s, claimed)
+	cancel()
+	stopHeartbeat()
+	// A permanent redirect may have merged the feed into another one.
+	feed = claimed.get()
+
+	if ctx.Err() != nil {
+		releaseLeases(s, []database.Feed{feed}, opts)
+		return fmt.Errorf("interrupted: %w", ctx.Err())
+	}
+	if markErr := recordFetch(ctx, s, feed, status, err, opts); markErr != nil {
+		err = errors.Join(err, markErr)
+	}
+	return err
+}
+
+// drainContext returns a context that outlives ctx by drain: it is only
+// cancelled once drain has passed after ctx is done, or when the returned
+// cancel function is called.
+func drainContext(ctx context.Context, drain time.Duration) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(drain, cancel)
+	})
+	return work, func() {
+		stop()
+		cancel()
+	}
+}
+
+// releaseLeases hands feeds this aggregator claimed but did not scrape back
+// so another aggregator can pick them up straight away.
+func releaseLeases(s *state, feeds []database.Feed, opts scrapeOptions) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	for _, feed := range feeds {
+		err := s.db.ReleaseFeedLease(ctx, database.ReleaseFeedLeaseParams{
+			ID:         feed.ID,
+			LeaseOwner: opts.workerID,
+		})
+		if err != nil {
+			log.Printf("failed to release the lease on %s: %v", feed.Name, err)
+		}
+	}
+}
+
+// claimedFeed is the feed a scrape is working on. It is replaced by the feed
+// it was merged into when a permanent redirect points at another feed, which
+// also takes over the lease.
+type claimedFeed struct {
+	mu   sync.Mutex
+	feed database.Feed
+}
+
+func (c *claimedFeed) get() database.Feed {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.feed
+}
+
+func (c *claimedFeed) set(feed database.Feed) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.feed = feed
+}
+
+// heartbeatLease keeps extending the lease on the claimed feed while it is
+// being scraped and returns a function that stops the heartbeat.
+func heartbeatLease(ctx context.Context, s *state, claimed *claimedFeed, opts scrapeOptions) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(opts.leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				feed := claimed.get()
+				n, err := s.db.ExtendFeedLease(ctx, database.ExtendFeedLeaseParams{
+					LeaseSeconds: int32(opts.leaseDuration / time.Second),
+					ID:           feed.ID,
+					LeaseOwner:   opts.workerID,
+				})
+				if err != nil {
+					log.Printf("failed to extend the lease on %s: %v", feed.Name, err)
+				} else if n == 0 {
+					log.Printf("lost the lease on %s to another aggregator", feed.Name)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// recordFetch releases the lease on feed and stores the outcome of the fetch.
+// Failures push the next fetch back exponentially and disable the feed once
+// it has failed maxFailures times in a row.
+func recordFetch(ctx context.Context, s *state, feed database.Feed, status int, scrapeErr error, opts scrapeOptions) error {
+	lastStatus := sql.NullInt32{Int32: int32(status), Valid: status != 0}
+	if scrapeErr == nil {
+		_, err := s.db.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+			ID:         feed.ID,
+			LastStatus: lastStatus,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// The feed was deleted meanwhile.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to mark the fetched feed: %w", err)
+		}
+		return nil
+	}
+
+	updated, err := s.db.MarkFeedFetchFailed(ctx, database.MarkFeedFetchFailedParams{
+		LastError:      scrapeErr.Error(),
+		LastStatus:     lastStatus,
+		BackoffSeconds: int32(fetchBackoff(feed.ConsecutiveFailures+1) / time.Second),
+		MaxFailures:    int32(opts.maxFailures),
+		ID:             feed.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the failed fetch: %w", err)
+	}
+	if updated.DisabledAt.Valid {
+		log.Printf("disabled %s after %d consecutive failures", feed.Name, updated.ConsecutiveFailures)
+	}
+	return nil
+}
+
+// fetchBackoff is how long to wait before fetching a feed again after its
+// failures-th consecutive failure.
+func fetchBackoff(failures int32) time.Duration {
+	backoff := baseFetchBackoff
+	for i := int32(1); i < failures && backoff < maxFetchBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxFetchBackoff)
+}
+
+// moveFeed points feed at newURL after it was permanently redirected there.
+// If newURL is already stored as another feed the two are merged into that
+// one, which is returned so the fetched posts are stored on it.
+func moveFeed(ctx context.Context, s *state, feed database.Feed, newURL string) (database.Feed, error) {
+	existing, err := s.db.GetFeedByURL(ctx, newURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = s.db.MoveFeed(ctx, database.MoveFeedParams{ID: feed.ID, Url: newURL})
+		if err != nil {
+			return feed, err
+		}
+		log.Printf("%s moved permanently from %s to %s", feed.Name, feed.Url, newURL)
+		feed.Url = newURL
+		return feed, nil
+	}
+	if err != nil {
+		return feed, err
+	}
+	err = s.db.MergeFeedInto(ctx, database.MergeFeedIntoParams{IntoID: existing.ID, FromID: feed.ID})
+	if err != nil {
+		return feed, err
+	}
+	log.Printf("%s moved permanently from %s to %s, merged it into %s", feed.Name, feed.Url, newURL, existing.Name)
+	return existing, nil
+}
+
+// scrapeFeed fetches a single feed and stores its new posts, returning the
+// HTTP status of the fetch if a response arrived. ctx bounds the whole scrape.
+// If the feed is merged into another one, claimed is switched to that feed.
+func scrapeFeed(ctx context.Context, s *state, claimed *claimedFeed) (int, error) {
+	feed := claimed.get()
+	result, err := fetchFeedConditional(ctx, feed.Url, feed.Etag.String, feed.LastModified.String)
+	status := 0
+	if result != nil {
+		status = result.StatusCode
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to make a HTTP request: %w", err)
+	}
+	if result.RedirectURL != "" && result.RedirectURL != feed.Url {
+		feed, err = moveFeed(ctx, s, feed, result.RedirectURL)
+		if err != nil {
+			return status, fmt.Errorf("failed to follow the permanent redirect: %w", err)
+		}
+		claimed.set(feed)
+	}
+	if result.NotModified {
+		fmt.Printf("%s has not changed since the last fetch\n", feed.Name)
+		return status, nil
+	}
+	data := result.Feed
+	fetchedAt := time.Now()
+	created, updated, failed := 0, 0, 0
+	for _, post := range data.Channel.Item {
+		guid := post.GUID
+		if guid == "" {
+			guid = post.Link
+		}
+		if guid == "" {
+			log.Printf("skipping post %q without a guid or link", post.Title)
+			continue
+		}
+		publishedAt, synthesized := resolvePubDate(post.PubDate, data.Channel.LastBuildDate, fetchedAt)
+		if synthesized && post.PubDate != "" {
+			fmt.Printf("could not parse pubDate %q, using %v\n", post.PubDate, publishedAt)
+		}
+		if post.Link != "" && guid != post.Link {
+			_, err := s.db.AdoptLegacyPostGUID(ctx, database.AdoptLegacyPostGUIDParams{
+				Guid:   guid,
+				FeedID: feed.ID,
+				Url:    post.Link,
+			})
+			if err != nil {
+				log.Printf("Couldn't save post: %v", err)
+				failed++
+				continue
+			}
+		}
+		row, err := s.db.UpsertPost(ctx, database.UpsertPostParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Title:     post.Title,
+			Url:       post.Link,
+			Description: sql.NullString{
+				String: post.Description,
+				Valid:  true,
+			},
+			PublishedAt:            publishedAt,
+			FeedID:                 feed.ID,
+			PublishedAtSynthesized: synthesized,
+			Guid:                   guid,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already stored and unchanged.
+			continue
+		}
+		if err != nil {
+			log.Printf("Couldn't save post: %v", err)
+			failed++
+			continue
+		}
+		if row.Inserted {
+			created++
+		} else {
+			updated++
+		}
+	}
+	fmt.Printf("%s: %d new posts, %d updated\n", feed.Name, created, updated)
+	if failed > 0 {
+		// Keep the old validators so the next fetch gets the posts again
+		// rather than a 304.
+		return status, fmt.Errorf("failed to save %d of %d posts", failed, len(data.Channel.Item))
+	}
+	err = s.db.UpdateFeedCacheHeaders(ctx, database.UpdateFeedCacheHeadersParams{
+		ID:           feed.ID,
+		Etag:         sql.NullString{String: result.ETag, Valid: result.ETag != ""},
+		LastModified: sql.NullString{String: result.LastModified, Valid: result.LastModified != ""},
+	})
+	if err != nil {
+		return status, fmt.Errorf("failed to store the feed cache headers: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/Kam1217/blog_aggregator/internal/memstore"
+	"github.com/google/uuid"
+)
+
+// failingUpserts is a store whose UpsertPost fails after the first ok calls.
+type failingUpserts struct {
+	*memstore.Store
+	ok int
+}
+
+func (s *failingUpserts) UpsertPost(ctx context.Context, arg database.UpsertPostParams) (database.UpsertPostRow, error) {
+	if s.ok == 0 {
+		return database.UpsertPostRow{}, errors.New("connection reset")
+	}
+	s.ok--
+	return s.Store.UpsertPost(ctx, arg)
+}
+
+func TestScrapeFeedKeepsValidatorsOnFailedPosts(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "rss_boot_dev.xml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	s, store := newTestState(t)
+	feed := createTestFeed(t, s, createTestUser(t, s, "kam"), "Boot.dev Blog", server.URL)
+	s.db = &failingUpserts{Store: store, ok: 1}
+
+	_, err = captureStdout(t, func() error {
+		_, err := scrapeFeed(ctx, s, &claimedFeed{feed: feed})
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected an error when a post could not be saved")
+	}
+	stored, err := store.GetFeedByURL(ctx, feed.Url)
+	if err != nil {
+		t.Fatalf("failed to get feed: %v", err)
+	}
+	if stored.Etag.Valid {
+		t.Errorf("expected the ETag not to be stored but got %q", stored.Etag.String)
+	}
+
+	s.db = store
+	_, err = captureStdout(t, func() error {
+		_, err := scrapeFeed(ctx, s, &claimedFeed{feed: stored})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("expected the next scrape to succeed but got: %v", err)
+	}
+	stored, err = store.GetFeedByURL(ctx, feed.Url)
+	if err != nil {
+		t.Fatalf("failed to get feed: %v", err)
+	}
+	if stored.Etag.String != `"v1"` {
+		t.Errorf("expected the ETag to be stored once every post was saved but got %+v", stored.Etag)
+	}
+}
+
+func TestScrapeFeedAdoptsLegacyPosts(t *testing.T) {
+	server := serveFixture(t, "atom_blogger.xml", "application/atom+xml")
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	feed := createTestFeed(t, s, user, "Google Developers Blog", server.URL)
+	if _, err := s.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedID: feed.ID,
+	}); err != nil {
+		t.Fatalf("failed to follow feed: %v", err)
+	}
+	// A post stored before posts had a guid, which the migration set to its url.
+	link := "https://developers.googleblog.com/2024/11/kotlin-multiplatform.html"
+	legacy, err := s.db.UpsertPost(ctx, database.UpsertPostParams{
+		ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Title: "Announcing Kotlin Multiplatform",
+		Url: link, PublishedAt: time.Now(), FeedID: feed.ID, Guid: link,
+	})
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if err := s.db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: user.ID, PostID: legacy.ID}); err != nil {
+		t.Fatalf("failed to mark post read: %v", err)
+	}
+
+	_, err = captureStdout(t, func() error {
+		_, err := scrapeFeed(ctx, s, &claimedFeed{feed: feed})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to scrape: %v", err)
+	}
+	posts, err := s.db.GetPostForUser(ctx, database.GetPostForUserParams{UserID: user.ID, Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to get posts: %v", err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("expected the legacy post to be updated rather than stored again but got %d posts", len(posts))
+	}
+	for _, post := range posts {
+		if post.Url == link && (post.ID != legacy.ID || !strings.HasPrefix(post.Guid, "tag:blogger.com")) {
+			t.Errorf("expected post %s to keep its id and take the entry's id as guid but got %+v", legacy.ID, post)
+		}
+	}
+	unread, err := s.db.GetPostForUser(ctx, database.GetPostForUserParams{UserID: user.ID, UnreadOnly: true, Limit: 10})
+	if err != nil || len(unread) != 1 {
+		t.Errorf("expected the read mark to survive but got %d unread, %v", len(unread), err)
+	}
+}
+
+func TestMoveFeed(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	kam := createTestUser(t, s, "kam")
+	bob := createTestUser(t, s, "bob")
+	follow := func(user database.User, feed database.Feed) {
+		t.Helper()
+		_, err := s.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+			ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedID: feed.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to follow feed: %v", err)
+		}
+	}
+	addPost := func(feed database.Feed, guid string) uuid.UUID {
+		t.Helper()
+		row, err := s.db.UpsertPost(ctx, database.UpsertPostParams{
+			ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Title: "Post " + guid,
+			Url: "https://example.com/posts/" + guid, PublishedAt: time.Now(), FeedID: feed.ID, Guid: guid,
+		})
+		if err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+		return row.ID
+	}
+
+	t.Run("new URL", func(t *testing.T) {
+		feed := createTestFeed(t, s, kam, "old", "https://old.example.com/feed")
+		moved, err := moveFeed(ctx, s, feed, "https://new.example.com/feed")
+		if err != nil {
+			t.Fatalf("failed to move feed: %v", err)
+		}
+		if moved.ID != feed.ID || moved.Url != "https://new.example.com/feed" {
+			t.Errorf("expected feed %s at the new URL but got %+v", feed.ID, moved)
+		}
+		if _, err := s.db.GetFeedByURL(ctx, "https://new.example.com/feed"); err != nil {
+			t.Errorf("expected the new URL to be stored but got: %v", err)
+		}
+	})
+
+	t.Run("merge into existing feed", func(t *testing.T) {
+		from := createTestFeed(t, s, kam, "from", "https://from.example.com/feed")
+		into := createTestFeed(t, s, bob, "into", "https://into.example.com/feed")
+		follow(kam, from)
+		follow(bob, from)
+		follow(bob, into)
+		shared := addPost(from, "shared")
+		addPost(from, "only-from")
+		addPost(into, "shared")
+		if err := s.db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: kam.ID, PostID: shared}); err != nil {
+			t.Fatalf("failed to mark post read: %v", err)
+		}
+
+		merged, err := moveFeed(ctx, s, from, into.Url)
+		if err != nil {
+			t.Fatalf("failed to move feed: %v", err)
+		}
+		if merged.ID != into.ID {
+			t.Errorf("expected the existing feed %s back but got %+v", into.ID, merged)
+		}
+		if _, err := s.db.GetFeedByURL(ctx, from.Url); err == nil {
+			t.Error("expected the moved feed to be deleted")
+		}
+		for _, user := range []database.User{kam, bob} {
+			follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("failed to get follows: %v", err)
+			}
+			if len(follows) != 1 || follows[0].FeedID != into.ID {
+				t.Errorf("expected %s to follow only %s once but got %+v", user.Name, into.Name, follows)
+			}
+			posts, err := s.db.GetPostForUser(ctx, database.GetPostForUserParams{UserID: user.ID, Limit: 10})
+			if err != nil {
+				t.Fatalf("failed to get posts: %v", err)
+			}
+			if len(posts) != 2 {
+				t.Errorf("expected the posts sharing a guid to be stored once but %s has %d posts", user.Name, len(posts))
+			}
+		}
+		unread, err := s.db.GetPostForUser(ctx, database.GetPostForUserParams{UserID: kam.ID, UnreadOnly: true, Limit: 10})
+		if err != nil || len(unread) != 1 || unread[0].Guid != "only-from" {
+			t.Errorf("expected kam's read mark to move to the kept post but got %+v, %v", unread, err)
+		}
+	})
+}
+
+// slowLeases is a store whose first UpsertPost waits for delay, recording the
+// feeds whose lease was extended meanwhile and whether the extension stuck.
+type slowLeases struct {
+	*memstore.Store
+	delay    time.Duration
+	mu       sync.Mutex
+	waited   bool
+	extended map[uuid.UUID]int64
+}
+
+func (s *slowLeases) UpsertPost(ctx context.Context, arg database.UpsertPostParams) (database.UpsertPostRow, error) {
+	s.mu.Lock()
+	wait := !s.waited
+	s.waited = true
+	s.mu.Unlock()
+	if wait {
+		time.Sleep(s.delay)
+	}
+	return s.Store.UpsertPost(ctx, arg)
+}
+
+func (s *slowLeases) ExtendFeedLease(ctx context.Context, arg database.ExtendFeedLeaseParams) (int64, error) {
+	n, err := s.Store.ExtendFeedLease(ctx, arg)
+	s.mu.Lock()
+	s.extended[arg.ID] += n
+	s.mu.Unlock()
+	return n, err
+}
+
+func TestScrapeClaimedFeedMerged(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "rss_boot_dev.xml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(data)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	s, store := newTestState(t)
+	opts := scrapeOptions{
+		fetchTimeout:  5 * time.Second,
+		leaseDuration: 3 * time.Second,
+		workerID:      "test",
+		maxFailures:   3,
+	}
+	// The first post is stored after the heartbeat has ticked once.
+	slow := &slowLeases{Store: store, delay: opts.leaseDuration/3 + 200*time.Millisecond, extended: map[uuid.UUID]int64{}}
+	s.db = slow
+	user := createTestUser(t, s, "kam")
+	from := createTestFeed(t, s, user, "old", server.URL+"/old")
+	into := createTestFeed(t, s, user, "new", server.URL+"/new")
+	claimed, err := store.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+		LeaseOwner: opts.workerID, LeaseSeconds: 3, DueBefore: time.Now(), BatchSize: 1,
+	})
+	if err != nil || len(claimed) != 1 || claimed[0].ID != from.ID {
+		t.Fatalf("expected to claim %s but got %+v, %v", from.Name, claimed, err)
+	}
+
+	_, err = captureStdout(t, func() error { return scrapeClaimedFeed(ctx, s, claimed[0], opts) })
+	if err != nil {
+		t.Fatalf("failed to scrape: %v", err)
+	}
+	if _, err := store.GetFeedByURL(ctx, from.Url); err == nil {
+		t.Error("expected the redirected feed to be merged away")
+	}
+	merged, err := store.GetFeedByURL(ctx, into.Url)
+	if err != nil {
+		t.Fatalf("failed to get feed: %v", err)
+	}
+	if !merged.LastFetchedAt.Valid || merged.LastStatus.Int32 != http.StatusOK || merged.Etag.String != `"v1"` {
+		t.Errorf("expected the fetch to be recorded on the feed it was merged into but got %+v", merged)
+	}
+	if merged.LeaseOwner.Valid {
+		t.Errorf("expected the lease handed over by the merge to be released but got %+v", merged.LeaseOwner)
+	}
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+	if slow.extended[into.ID] == 0 || slow.extended[from.ID] != 0 {
+		t.Errorf("expected the heartbeat to extend the lease on the merged feed but got %v", slow.extended)
+	}
+}
+
+func TestFetchBackoff(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{5, 80 * time.Minute},
+		{9, 1280 * time.Minute},
+		{10, 24 * time.Hour},
+		{11, 24 * time.Hour},
+		{1000, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := fetchBackoff(tt.failures); got != tt.want {
+			t.Errorf("fetchBackoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRecordFetch(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestState(t)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time { return now }
+	feed := createTestFeed(t, s, createTestUser(t, s, "kam"), "flaky", "https://example.com/feed")
+	opts := scrapeOptions{maxFailures: 3}
+	record := func(status int, scrapeErr error) database.Feed {
+		t.Helper()
+		current, err := store.GetFeedByURL(ctx, feed.Url)
+		if err != nil {
+			t.Fatalf("failed to get feed: %v", err)
+		}
+		if err := recordFetch(ctx, s, current, status, scrapeErr, opts); err != nil {
+			t.Fatalf("failed to record fetch: %v", err)
+		}
+		updated, err := store.GetFeedByURL(ctx, feed.Url)
+		if err != nil {
+			t.Fatalf("failed to get feed: %v", err)
+		}
+		return updated
+	}
+
+	for i, backoff := range []time.Duration{5 * time.Minute, 10 * time.Minute} {
+		failed := record(http.StatusServiceUnavailable, errors.New("HTTP 503"))
+		if failed.ConsecutiveFailures != int32(i+1) || failed.LastError.String != "HTTP 503" || failed.LastStatus.Int32 != 503 {
+			t.Errorf("failure %d: expected the failure to be recorded but got %+v", i+1, failed)
+		}
+		if !failed.NextFetchAt.Time.Equal(now.Add(backoff)) {
+			t.Errorf("failure %d: expected the next fetch after %v but got %v", i+1, backoff, failed.NextFetchAt.Time)
+		}
+		if failed.DisabledAt.Valid {
+			t.Errorf("failure %d: expected the feed to stay enabled", i+1)
+		}
+	}
+
+	fetched := record(http.StatusOK, nil)
+	if fetched.ConsecutiveFailures != 0 || fetched.LastError.Valid || fetched.NextFetchAt.Valid {
+		t.Errorf("expected a success to reset the failures but got %+v", fetched)
+	}
+
+	for i := 1; i <= opts.maxFailures; i++ {
+		failed := record(0, errors.New("connection refused"))
+		if disabled := i == opts.maxFailures; failed.DisabledAt.Valid != disabled {
+			t.Errorf("failure %d: expected disabled to be %v but got %+v", i, disabled, failed.DisabledAt)
+		}
+		if failed.LastStatus.Valid {
+			t.Errorf("failure %d: expected no status without a response but got %d", i, failed.LastStatus.Int32)
+		}
+	}
+	// Well past any backoff, so only disabled_at keeps the feed back.
+	later := now.Add(48 * time.Hour)
+	store.Now = func() time.Time { return later }
+	claimed, err := store.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+		LeaseOwner: "test", LeaseSeconds: 60, DueBefore: later, BatchSize: 10,
+	})
+	if err != nil || len(claimed) != 0 {
+		t.Errorf("expected a disabled feed not to be fetched again but got %+v, %v", claimed, err)
+	}
+}
+
+func TestScrapeFeedsConcurrency(t *testing.T) {
+	const feeds, concurrency = 6, 2
+	data, err := os.ReadFile(filepath.Join("testdata", "rss_boot_dev.xml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if n <= seen || maxInFlight.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	s, store := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	var urls []string
+	for i := range feeds {
+		url := fmt.Sprintf("%s/feed/%d", server.URL, i)
+		createTestFeed(t, s, user, fmt.Sprintf("feed %d", i), url)
+		urls = append(urls, url)
+	}
+
+	opts := scrapeOptions{
+		batchSize:     feeds,
+		concurrency:   concurrency,
+		fetchTimeout:  5 * time.Second,
+		leaseDuration: time.Minute,
+		drainTimeout:  time.Second,
+		workerID:      "test",
+		maxFailures:   3,
+		dueBefore:     time.Now(),
+	}
+	var n int
+	_, err = captureStdout(t, func() error {
+		var err error
+		n, err = scrapeFeeds(ctx, s, opts)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to scrape: %v", err)
+	}
+	if n != feeds {
+		t.Errorf("expected %d feeds to be claimed but got %d", feeds, n)
+	}
+	if got := maxInFlight.Load(); got != concurrency {
+		t.Errorf("expected the pool to run %d fetches at once but saw up to %d", concurrency, got)
+	}
+	for _, url := range urls {
+		feed, err := store.GetFeedByURL(ctx, url)
+		if err != nil {
+			t.Fatalf("failed to get feed: %v", err)
+		}
+		if !feed.LastFetchedAt.Valid || feed.LeaseOwner.Valid {
+			t.Errorf("expected %s to be scraped and released but got %+v", url, feed)
+		}
+	}
+}
+
+func TestReleaseLeases(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	mine := createTestFeed(t, s, user, "mine", "https://example.com/mine")
+	theirs := createTestFeed(t, s, user, "theirs", "https://example.com/theirs")
+	claim := func(owner string, batch int32) []database.Feed {
+		t.Helper()
+		feeds, err := store.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseOwner: owner, LeaseSeconds: 60, DueBefore: time.Now(), BatchSize: batch,
+		})
+		if err != nil {
+			t.Fatalf("failed to claim feeds: %v", err)
+		}
+		return feeds
+	}
+	if claimed := claim("test", 1); len(claimed) != 1 || claimed[0].ID != mine.ID {
+		t.Fatalf("expected to claim %s but got %+v", mine.Name, claimed)
+	}
+	if claimed := claim("other", 1); len(claimed) != 1 || claimed[0].ID != theirs.ID {
+		t.Fatalf("expected to claim %s but got %+v", theirs.Name, claimed)
+	}
+
+	releaseLeases(s, []database.Feed{mine, theirs}, scrapeOptions{workerID: "test"})
+	released, err := store.GetFeedByURL(ctx, mine.Url)
+	if err != nil || released.LeaseOwner.Valid || released.LeaseExpiresAt.Valid {
+		t.Errorf("expected the lease on %s to be cleared but got %+v, %v", mine.Name, released, err)
+	}
+	kept, err := store.GetFeedByURL(ctx, theirs.Url)
+	if err != nil || kept.LeaseOwner.String != "other" {
+		t.Errorf("expected the lease another aggregator holds to be kept but got %+v, %v", kept, err)
+	}
+	if claimed := claim("next", 2); len(claimed) != 1 || claimed[0].ID != mine.ID {
+		t.Errorf("expected the released feed to be claimable straight away but got %+v", claimed)
+	}
+}
+
+func TestDrainContext(t *testing.T) {
+	const drain = 100 * time.Millisecond
+
+	t.Run("outlives the parent by drain", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.Background())
+		work, cancel := drainContext(parent, drain)
+		defer cancel()
+		if work.Err() != nil {
+			t.Fatal("expected the context to be alive before the parent is cancelled")
+		}
+		cancelParent()
+		cancelled := time.Now()
+		time.Sleep(drain / 2)
+		if work.Err() != nil {
+			t.Fatal("expected the context to outlive its parent while draining")
+		}
+		select {
+		case <-work.Done():
+		case <-time.After(time.Second):
+			t.Fatal("expected the context to be cancelled once drain passed")
+		}
+		if elapsed := time.Since(cancelled); elapsed < drain {
+			t.Errorf("expected the context to last %v after its parent but it was cancelled after %v", drain, elapsed)
+		}
+		if !errors.Is(work.Err(), context.Canceled) {
+			t.Errorf("expected context.Canceled but got %v", work.Err())
+		}
+	})
+
+	t.Run("cancel stops it at once", func(t *testing.T) {
+		work, cancel := drainContext(context.Background(), drain)
+		cancel()
+		if work.Err() == nil {
+			t.Error("expected the returned cancel function to cancel the context")
+		}
+	})
+}
+
+func TestScrapeDueFeeds(t *testing.T) {
+	opts := scrapeOptions{
+		batchSize:     10,
+		concurrency:   2,
+		fetchTimeout:  5 * time.Second,
+		leaseDuration: time.Minute,
+		drainTimeout:  50 * time.Millisecond,
+		workerID:      "test",
+		maxFailures:   3,
+	}
+
+	t.Run("failed feed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "gone", http.StatusInternalServerError)
+		}))
+		t.Cleanup(server.Close)
+		s, store := newTestState(t)
+		user := createTestUser(t, s, "kam")
+		createTestFeed(t, s, user, "fine", serveFixture(t, "rss_boot_dev.xml", "application/rss+xml").URL)
+		feed := createTestFeed(t, s, user, "broken", server.URL)
+
+		_, err := captureStdout(t, func() error {
+			return handlerAgg(context.Background(), s, command{name: "agg", args: []string{"--once"}})
+		})
+		if err == nil || !strings.Contains(err.Error(), "broken") {
+			t.Errorf("expected agg --once to fail because of the broken feed but got: %v", err)
+		}
+		failed, err := store.GetFeedByURL(context.Background(), feed.Url)
+		if err != nil || failed.ConsecutiveFailures != 1 {
+			t.Errorf("expected the failure to be recorded but got %+v, %v", failed, err)
+		}
+	})
+
+	t.Run("non-positive interval", func(t *testing.T) {
+		s, _ := newTestState(t)
+		for _, args := range [][]string{{"0s"}, {"--", "-1m"}} {
+			err := handlerAgg(context.Background(), s, command{name: "agg", args: args})
+			if err == nil || !strings.Contains(err.Error(), "must be positive") {
+				t.Errorf("expected agg %v to be rejected but got: %v", args, err)
+			}
+		}
+	})
+
+	// slowFeed serves the fixture once release is closed, telling started
+	// when a request arrives.
+	slowFeed := func(t *testing.T, started chan<- struct{}, release <-chan struct{}) *httptest.Server {
+		data, err := os.ReadFile(filepath.Join("testdata", "rss_boot_dev.xml"))
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			select {
+			case <-release:
+				w.Write(data)
+			case <-r.Context().Done():
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	t.Run("interrupted past the drain", func(t *testing.T) {
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		s, store := newTestState(t)
+		feed := createTestFeed(t, s, createTestUser(t, s, "kam"), "slow", slowFeed(t, started, release).URL)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			_, err := captureStdout(t, func() error { return scrapeDueFeeds(ctx, s, opts) })
+			done <- err
+		}()
+		<-started
+		cancel()
+		err := <-done
+		close(release)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the scrape to report the interruption but got: %v", err)
+		}
+		released, err := store.GetFeedByURL(context.Background(), feed.Url)
+		if err != nil {
+			t.Fatalf("failed to get feed: %v", err)
+		}
+		if released.LeaseOwner.Valid || released.LastFetchedAt.Valid || released.ConsecutiveFailures != 0 {
+			t.Errorf("expected the feed to be handed back untouched but got %+v", released)
+		}
+	})
+
+	t.Run("finished within the drain", func(t *testing.T) {
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		s, store := newTestState(t)
+		feed := createTestFeed(t, s, createTestUser(t, s, "kam"), "slow", slowFeed(t, started, release).URL)
+		ctx, cancel := context.WithCancel(context.Background())
+		drainOpts := opts
+		drainOpts.drainTimeout = 5 * time.Second
+		done := make(chan error)
+		go func() {
+			_, err := captureStdout(t, func() error { return scrapeDueFeeds(ctx, s, drainOpts) })
+			done <- err
+		}()
+		<-started
+		cancel()
+		close(release)
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the scrape to report the interruption but got: %v", err)
+		}
+		fetched, err := store.GetFeedByURL(context.Background(), feed.Url)
+		if err != nil {
+			t.Fatalf("failed to get feed: %v", err)
+		}
+		if !fetched.LastFetchedAt.Valid || fetched.LeaseOwner.Valid {
+			t.Errorf("expected the fetch in flight to finish and be recorded but got %+v", fetched)
+		}
+	})
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPostsPageSize = 20
+	maxPostsPageSize     = 100
+	// maxRequestBody bounds the JSON bodies the API accepts.
+	maxRequestBody = 1 << 20
+	// shutdownTimeout is how long requests in flight get to finish once
+	// serve is asked to stop.
+	shutdownTimeout = 10 * time.Second
+)
+
+// apiError is an error with the HTTP status and message to report to the
+// client. Any other error a handler returns is logged and reported as a 500.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func apiErrorf(status int, format string, args ...any) error {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+type apiHandler func(w http.ResponseWriter, r *http.Request, s *state) error
+
+func handlerServe(ctx context.Context, s *state, cmd command) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("usage: serve [--addr host:port]")
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           newAPIHandler(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	fmt.Printf("Serving the API on http://%s\n", *addr)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to serve the API: %w", err)
+	case <-ctx.Done():
+	}
+	fmt.Println("Shutting down, finishing requests in flight...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down the API: %w", err)
+	}
+	return nil
+}
+
+// newAPIHandler returns the routes of the JSON API. Apart from registering,
+// requests need an API token from token create in an Authorization: Bearer
+// header, with the scope the route needs. Routes under /api/users/{user} only
+// accept the tokens of that user.
+func newAPIHandler(s *state) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler apiHandler) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			serveAPI(w, r, s, handler)
+		})
+	}
+	handle("POST /api/users", apiCreateUser)
+	handle("GET /api/feeds", apiAuthenticated(scopeRead, apiListFeeds))
+	handle("POST /api/users/{user}/feeds", apiUser(scopeManageFeeds, apiCreateFeed))
+	handle("GET /api/users/{user}/follows", apiUser(scopeRead, apiListFollows))
+	handle("POST /api/users/{user}/follows", apiUser(scopeWrite, apiCreateFollow))
+	handle("DELETE /api/users/{user}/follows/{feedID}", apiUser(scopeWrite, apiDeleteFollow))
+	handle("GET /api/users/{user}/posts", apiUser(scopeRead, apiListPosts))
+	return mux
+}
+
+func serveAPI(w http.ResponseWriter, r *http.Request, s *state, handler apiHandler) {
+	err := handler(w, r, s)
+	if err == nil {
+		return
+	}
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		apiErr = &apiError{status: http.StatusInternalServerError, message: "internal server error"}
+	}
+	respondWithJSON(w, apiErr.status, map[string]string{"error": apiErr.message})
+}
+
+// apiAuthenticated runs handler as the owner of the request's bearer token,
+// like middlewareLoggedIn does with GATOR_TOKEN.
+func apiAuthenticated(scope string, handler func(w http.ResponseWriter, r *http.Request, s *state, user database.User) error) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request, s *state) error {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			return apiErrorf(http.StatusUnauthorized, "an API token is required, see token create")
+		}
+		user, scopes, err := authenticateToken(r.Context(), s, token)
+		if errors.Is(err, errInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			return apiErrorf(http.StatusUnauthorized, "%v", err)
+		}
+		if err != nil {
+			return err
+		}
+		if !hasScope(scopes, scope) {
+			return apiErrorf(http.StatusForbidden, "the API token lacks the %s scope", scope)
+		}
+		return handler(w, r, s, user)
+	}
+}
+
+// apiUser is apiAuthenticated for routes under /api/users/{user}, which only
+// the named user's tokens may use.
+func apiUser(scope string, handler func(w http.ResponseWriter, r *http.Request, s *state, user database.User) error) apiHandler {
+	return apiAuthenticated(scope, func(w http.ResponseWriter, r *http.Request, s *state, user database.User) error {
+		if name := r.PathValue("user"); name != user.Name {
+			return apiErrorf(http.StatusForbidden, "the API token belongs to another user than %q", name)
+		}
+		return handler(w, r, s, user)
+	})
+}
+
+func respondWithJSON(w http.ResponseWriter, status int, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("failed to encode response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return apiErrorf(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+type userResponse struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+}
+
+type feedResponse struct {
+	ID                  uuid.UUID  `json:"id"`
+	Name                string     `json:"name"`
+	URL                 string     `json:"url"`
+	User                string     `json:"user"`
+	LastFetchedAt       *time.Time `json:"last_fetched_at"`
+	LastStatus          *int32     `json:"last_status"`
+	LastError           *string    `json:"last_error"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	NextFetchAt         *time.Time `json:"next_fetch_at"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+}
+
+type followResponse struct {
+	FeedID      uuid.UUID `json:"feed_id"`
+	FeedName    string    `json:"feed_name"`
+	FeedURL     string    `json:"feed_url"`
+	Category    *string   `json:"category"`
+	UnreadCount int64     `json:"unread_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type postResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description *string   `json:"description"`
+	PublishedAt time.Time `json:"published_at"`
+	// PublishedAtEstimated is set when the feed gave no usable date for the
+	// post, the "(estimated)" browse prints.
+	PublishedAtEstimated bool      `json:"published_at_estimated"`
+	FeedID               uuid.UUID `json:"feed_id"`
+	FeedName             string    `json:"feed_name"`
+}
+
+type postsResponse struct {
+	Posts []postResponse `json:"posts"`
+	// NextOffset is the offset of the next page, or nil on the last one.
+	NextOffset *int `json:"next_offset"`
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullInt32(i sql.NullInt32) *int32 {
+	if !i.Valid {
+		return nil
+	}
+	return &i.Int32
+}
+
+func newFeedResponse(feed database.Feed, userName string) feedResponse {
+	return feedResponse{
+		ID:                  feed.ID,
+		Name:                feed.Name,
+		URL:                 feed.Url,
+		User:                userName,
+		LastFetchedAt:       nullTime(feed.LastFetchedAt),
+		LastStatus:          nullInt32(feed.LastStatus),
+		LastError:           nullString(feed.LastError),
+		ConsecutiveFailures: feed.ConsecutiveFailures,
+		NextFetchAt:         nullTime(feed.NextFetchAt),
+		DisabledAt:          nullTime(feed.DisabledAt),
+	}
+}
+
+func newFollowResponse(follow database.GetFeedFollowsForUserRow) followResponse {
+	return followResponse{
+		FeedID:      follow.FeedID,
+		FeedName:    follow.FeedName,
+		FeedURL:     follow.FeedUrl,
+		Category:    nullString(follow.Category),
+		UnreadCount: follow.UnreadCount,
+		CreatedAt:   follow.CreatedAt,
+	}
+}
+
+func apiCreateUser(w http.ResponseWriter, r *http.Request, s *state) error {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		return err
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return apiErrorf(http.StatusBadRequest, "name is required")
+	}
+	if _, err := s.db.GetUser(r.Context(), body.Name); err == nil {
+		return apiErrorf(http.StatusConflict, "user %q already exists", body.Name)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check for an existing user: %w", err)
+	}
+	user, err := s.db.CreateUser(r.Context(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      body.Name,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	respondWithJSON(w, http.StatusCreated, userResponse{ID: user.ID, CreatedAt: user.CreatedAt, Name: user.Name})
+	return nil
+}
+
+func apiListFeeds(w http.ResponseWriter, r *http.Request, s *state, _ database.User) error {
+	feeds, err := s.db.GetFeeds(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get feeds: %w", err)
+	}
+	resp := make([]feedResponse, 0, len(feeds))
+	for _, feed := range feeds {
+		resp = append(resp, feedResponse{
+			ID:                  feed.ID,
+			Name:                feed.Name,
+			URL:                 feed.Url,
+			User:                feed.Name_2,
+			LastFetchedAt:       nullTime(feed.LastFetchedAt),
+			LastStatus:          nullInt32(feed.LastStatus),
+			LastError:           nullString(feed.LastError),
+			ConsecutiveFailures: feed.ConsecutiveFailures,
+			NextFetchAt:         nullTime(feed.NextFetchAt),
+			DisabledAt:          nullTime(feed.DisabledAt),
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// apiCreateFeed adds a feed and follows it, like addfeed. The feed is fetched
+// first unless no_verify is set, in which case name is required.
+func apiCreateFeed(w http.ResponseWriter, r *http.Request, s *state, user database.User) error {
+	var body struct {
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		NoVerify bool   `json:"no_verify"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		return err
+	}
+	if body.URL == "" {
+		return apiErrorf(http.StatusBadRequest, "url is required")
+	}
+	feedURL, name := body.URL, body.Name
+	if body.NoVerify {
+		if name == "" {
+			return apiErrorf(http.StatusBadRequest, "name is required with no_verify")
+		}
+	} else {
+		var err error
+		feedURL, name, err = verifyFeed(r.Context(), feedURL, name)
+		if err != nil {
+			return apiErrorf(http.StatusUnprocessableEntity, "%v", err)
+		}
+	}
+	if _, err := s.db.GetFeedByURL(r.Context(), feedURL); err == nil {
+		return apiErrorf(http.StatusConflict, "a feed with the URL %s already exists", feedURL)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check for an existing feed: %w", err)
+	}
+
+	feed, err := s.db.CreateFeed(r.Context(), database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      name,
+		Url:       feedURL,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create feed: %w", err)
+	}
+	_, err = s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to auto-follow new feed: %w", err)
+	}
+	respondWithJSON(w, http.StatusCreated, newFeedResponse(feed, user.Name))
+	return nil
+}
+
+func apiListFollows(w http.ResponseWriter, r *http.Request, s *state, user database.User) error {
+	follows, err := s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get follows: %w", err)
+	}
+	resp := make([]followResponse, 0, len(follows))
+	for _, follow := range follows {
+		resp = append(resp, newFollowResponse(follow))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+func apiCreateFollow(w http.ResponseWriter, r *http.Request, s *state, user database.User) error {
+	var body struct {
+		FeedURL  string `json:"feed_url"`
+		Category string `json:"category"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		return err
+	}
+	if body.FeedURL == "" {
+		return apiErrorf(http.StatusBadRequest, "feed_url is required")
+	}
+	feed, err := s.db.GetFeedByURL(r.Context(), body.FeedURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiErrorf(http.StatusNotFound, "no feed with the URL %s", body.FeedURL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get feed: %w", err)
+	}
+	if _, ok, err := findFollow(r.Context(), s, user, feed.ID); err != nil {
+		return err
+	} else if ok {
+		return apiErrorf(http.StatusConflict, "%s already follows %s", user.Name, feed.Name)
+	}
+
+	_, err = s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+		Category:  sql.NullString{String: body.Category, Valid: body.Category != ""},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to follow feed: %w", err)
+	}
+	// Read the follow back for its unread count.
+	follow, _, err := findFollow(r.Context(), s, user, feed.ID)
+	if err != nil {
+		return err
+	}
+	respondWithJSON(w, http.StatusCreated, newFollowResponse(follow))
+	return nil
+}
+
+func apiDeleteFollow(w http.ResponseWriter, r *http.Request, s *state, user database.User) error {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		return apiErrorf(http.StatusBadRequest, "invalid feed id %q", r.PathValue("feedID"))
+	}
+	if _, ok, err := findFollow(r.Context(), s, user, feedID); err != nil {
+		return err
+	} else if !ok {
+		return apiErrorf(http.StatusNotFound, "%s does not follow feed %s", user.Name, feedID)
+	}
+	err = s.db.DeleteFollows(r.Context(), database.DeleteFollowsParams{
+		UserID: user.ID,
+		FeedID: feedID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unfollow feed: %w", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func findFollow(ctx context.Context, s *state, user database.User, feedID uuid.UUID) (database.GetFeedFollowsForUserRow, bool, error) {
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return database.GetFeedFollowsForUserRow{}, false, fmt.Errorf("failed to get follows: %w", err)
+	}
+	for _, follow := range follows {
+		if follow.FeedID == feedID {
+			return follow, true, nil
+		}
+	}
+	return database.GetFeedFollowsForUserRow{}, false, nil
+}
+
+// apiListPosts pages through the posts of the feeds user follows, newest
+// first. It takes limit, offset, unread=true and feed_id query parameters.
+func apiListPosts(w http.ResponseWriter, r *http.Request, s *state, user database.User) error {
+	query := r.URL.Query()
+	limit, err := queryInt(query.Get("limit"), defaultPostsPageSize)
+	if err != nil || limit < 1 || limit > maxPostsPageSize {
+		return apiErrorf(http.StatusBadRequest, "limit must be a number from 1 to %d", maxPostsPageSize)
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 || offset > math.MaxInt32-maxPostsPageSize-1 {
+		return apiErrorf(http.StatusBadRequest, "offset must be a number of 0 or more")
+	}
+	var unreadOnly bool
+	if value := query.Get("unread"); value != "" {
+		if unreadOnly, err = strconv.ParseBool(value); err != nil {
+			return apiErrorf(http.StatusBadRequest, "unread must be true or false")
+		}
+	}
+	var feedID uuid.NullUUID
+	if value := query.Get("feed_id"); value != "" {
+		if feedID.UUID, err = uuid.Parse(value); err != nil {
+			return apiErrorf(http.StatusBadRequest, "invalid feed_id %q", value)
+		}
+		feedID.Valid = true
+	}
+
+	// Ask for one more post than the page holds to tell if there is a next
+	// page.
+	posts, err := s.db.GetPostForUser(r.Context(), database.GetPostForUserParams{
+		UserID:     user.ID,
+		UnreadOnly: unreadOnly,
+		FeedID:     feedID,
+		Limit:      int32(limit + 1),
+		Offset:     int32(offset),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get posts for user: %w", err)
+	}
+	resp := postsResponse{Posts: make([]postResponse, 0, min(len(posts), limit))}
+	if len(posts) > limit {
+		posts = posts[:limit]
+		next := offset + limit
+		resp.NextOffset = &next
+	}
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, postResponse{
+			ID:                   post.ID,
+			Title:                post.Title,
+			URL:                  post.Url,
+			Description:          nullString(post.Description),
+			PublishedAt:          post.PublishedAt,
+			PublishedAtEstimated: post.PublishedAtSynthesized,
+			FeedID:               post.FeedID,
+			FeedName:             post.FeedName,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// doAPI sends a request with token, if it is not empty, to the API and
+// decodes the JSON response into out, if out is not nil, returning the status
+// code.
+func doAPI(t *testing.T, s *state, method, path, token, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	newAPIHandler(s).ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: failed to decode response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAPIUsers(t *testing.T) {
+	s, _ := newTestState(t)
+
+	var user userResponse
+	if code := doAPI(t, s, "POST", "/api/users", "", `{"name": "kam"}`, &user); code != http.StatusCreated {
+		t.Fatalf("expected 201 but got %d", code)
+	}
+	if user.Name != "kam" || user.ID == uuid.Nil {
+		t.Errorf("expected the new user but got %+v", user)
+	}
+	if s.cfg.CurrentUserName != "" {
+		t.Errorf("expected registering through the API not to log in but the current user is %q", s.cfg.CurrentUserName)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"duplicate", `{"name": "kam"}`, http.StatusConflict},
+		{"empty name", `{"name": ""}`, http.StatusBadRequest},
+		{"unknown field", `{"name": "bob", "admin": true}`, http.StatusBadRequest},
+		{"not json", `name=bob`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp map[string]string
+			if code := doAPI(t, s, "POST", "/api/users", "", tt.body, &resp); code != tt.want {
+				t.Errorf("expected %d but got %d", tt.want, code)
+			}
+			if resp["error"] == "" {
+				t.Errorf("expected an error message but got %v", resp)
+			}
+		})
+	}
+}
+
+func TestAPIFeedsAndFollows(t *testing.T) {
+	s, _ := newTestState(t)
+	kam := createTestToken(t, s, createTestUser(t, s, "kam"), scopeRead, scopeManageFeeds)
+	bob := createTestToken(t, s, createTestUser(t, s, "bob"), scopeRead, scopeWrite)
+
+	var feed feedResponse
+	body := `{"name": "Example", "url": "https://example.com/feed", "no_verify": true}`
+	if code := doAPI(t, s, "POST", "/api/users/kam/feeds", kam, body, &feed); code != http.StatusCreated {
+		t.Fatalf("expected 201 but got %d", code)
+	}
+	if feed.Name != "Example" || feed.User != "kam" || feed.LastFetchedAt != nil {
+		t.Errorf("expected the new feed but got %+v", feed)
+	}
+	if code := doAPI(t, s, "POST", "/api/users/kam/feeds", kam, body, nil); code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate feed but got %d", code)
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		server := serveFixture(t, "rss_boot_dev.xml", "application/rss+xml")
+		var verified feedResponse
+		code := doAPI(t, s, "POST", "/api/users/kam/feeds", kam, fmt.Sprintf(`{"url": %q}`, server.URL), &verified)
+		if code != http.StatusCreated {
+			t.Fatalf("expected 201 but got %d", code)
+		}
+		if verified.Name != "Boot.dev Blog" {
+			t.Errorf("expected the feed's title as its name but got %q", verified.Name)
+		}
+		code = doAPI(t, s, "POST", "/api/users/kam/feeds", kam, `{"url": "http://127.0.0.1:1/feed"}`, nil)
+		if code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 for a feed that cannot be fetched but got %d", code)
+		}
+	})
+
+	var feeds []feedResponse
+	if code := doAPI(t, s, "GET", "/api/feeds", bob, "", &feeds); code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d", code)
+	}
+	if len(feeds) != 2 {
+		t.Fatalf("expected 2 feeds but got %+v", feeds)
+	}
+
+	var follow followResponse
+	code := doAPI(t, s, "POST", "/api/users/bob/follows", bob, `{"feed_url": "https://example.com/feed", "category": "News"}`, &follow)
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201 but got %d", code)
+	}
+	if follow.FeedID != feed.ID || follow.Category == nil || *follow.Category != "News" {
+		t.Errorf("expected a follow of %s in News but got %+v", feed.ID, follow)
+	}
+	if code := doAPI(t, s, "POST", "/api/users/bob/follows", bob, `{"feed_url": "https://example.com/feed"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate follow but got %d", code)
+	}
+	if code := doAPI(t, s, "POST", "/api/users/bob/follows", bob, `{"feed_url": "https://example.com/missing"}`, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown feed but got %d", code)
+	}
+
+	var follows []followResponse
+	if code := doAPI(t, s, "GET", "/api/users/bob/follows", bob, "", &follows); code != http.StatusOK || len(follows) != 1 {
+		t.Fatalf("expected bob's follow but got %d, %+v", code, follows)
+	}
+
+	path := "/api/users/bob/follows/" + feed.ID.String()
+	if code := doAPI(t, s, "DELETE", path, bob, "", nil); code != http.StatusNoContent {
+		t.Errorf("expected 204 but got %d", code)
+	}
+	if code := doAPI(t, s, "DELETE", path, bob, "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a feed that is not followed but got %d", code)
+	}
+	if code := doAPI(t, s, "DELETE", "/api/users/bob/follows/not-a-uuid", bob, "", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid feed id but got %d", code)
+	}
+	if code := doAPI(t, s, "GET", "/api/users/bob/follows", bob, "", &follows); code != http.StatusOK || len(follows) != 0 {
+		t.Errorf("expected no follows left but got %d, %+v", code, follows)
+	}
+}
+
+func TestAPIPosts(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	token := createTestToken(t, s, user, scopeRead)
+	var feeds []database.Feed
+	for _, name := range []string{"first", "second"} {
+		feed := createTestFeed(t, s, user, name, "https://example.com/"+name)
+		_, err := s.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+			ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedID: feed.ID,
+		})
+		if err != nil {
+			t.Fatalf("failed to follow feed: %v", err)
+		}
+		feeds = append(feeds, feed)
+	}
+	// Five posts, alternating between the feeds, the newest last.
+	var postIDs []uuid.UUID
+	for i := range 5 {
+		row, err := s.db.UpsertPost(ctx, database.UpsertPostParams{
+			ID:          uuid.New(),
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+			Title:       fmt.Sprintf("Post %d", i),
+			Url:         fmt.Sprintf("https://example.com/posts/%d", i),
+			Description: sql.NullString{String: "A post", Valid: true},
+			PublishedAt: time.Date(2025, 1, i+1, 0, 0, 0, 0, time.UTC),
+			FeedID:      feeds[i%2].ID,
+			Guid:        fmt.Sprint(i),
+		})
+		if err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+		postIDs = append(postIDs, row.ID)
+	}
+	if err := s.db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: user.ID, PostID: postIDs[4]}); err != nil {
+		t.Fatalf("failed to mark post read: %v", err)
+	}
+
+	titles := func(resp postsResponse) string {
+		var titles []string
+		for _, post := range resp.Posts {
+			titles = append(titles, post.Title)
+		}
+		return strings.Join(titles, ", ")
+	}
+	tests := []struct {
+		query      string
+		want       string
+		nextOffset int
+	}{
+		{"", "Post 4, Post 3, Post 2, Post 1, Post 0", 0},
+		{"?limit=2", "Post 4, Post 3", 2},
+		{"?limit=2&offset=2", "Post 2, Post 1", 4},
+		{"?limit=2&offset=4", "Post 0", 0},
+		{"?offset=10", "", 0},
+		{"?unread=true", "Post 3, Post 2, Post 1, Post 0", 0},
+		{"?feed_id=" + feeds[1].ID.String(), "Post 3, Post 1", 0},
+		{"?unread=1&feed_id=" + feeds[0].ID.String() + "&limit=1", "Post 2", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var resp postsResponse
+			if code := doAPI(t, s, "GET", "/api/users/kam/posts"+tt.query, token, "", &resp); code != http.StatusOK {
+				t.Fatalf("expected 200 but got %d", code)
+			}
+			if got := titles(resp); got != tt.want {
+				t.Errorf("expected posts %q but got %q", tt.want, got)
+			}
+			if tt.nextOffset == 0 && resp.NextOffset != nil {
+				t.Errorf("expected the last page but got next_offset %d", *resp.NextOffset)
+			}
+			if tt.nextOffset != 0 && (resp.NextOffset == nil || *resp.NextOffset != tt.nextOffset) {
+				t.Errorf("expected next_offset %d but got %v", tt.nextOffset, resp.NextOffset)
+			}
+		})
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?limit=ten", "?offset=-1", "?unread=maybe", "?feed_id=first"} {
+		if code := doAPI(t, s, "GET", "/api/users/kam/posts"+query, token, "", nil); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 but got %d", query, code)
+		}
+	}
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	createTestUser(t, s, "bob")
+	reader := createTestToken(t, s, user, scopeRead)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"no token", "GET", "/api/feeds", "", http.StatusUnauthorized},
+		{"unknown token", "GET", "/api/feeds", "gator_unknown", http.StatusUnauthorized},
+		{"read", "GET", "/api/users/kam/posts", reader, http.StatusOK},
+		{"another user", "GET", "/api/users/bob/posts", reader, http.StatusForbidden},
+		{"missing scope", "POST", "/api/users/kam/follows", reader, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doAPI(t, s, tt.method, tt.path, tt.token, `{"feed_url": "https://example.com/feed"}`, nil); code != tt.want {
+				t.Errorf("expected %d but got %d", tt.want, code)
+			}
+		})
+	}
+
+	deleted, err := s.db.DeleteAPIToken(ctx, database.DeleteAPITokenParams{UserID: user.ID, Ref: "test"})
+	if err != nil || deleted != 1 {
+		t.Fatalf("failed to revoke token: %d, %v", deleted, err)
+	}
+	if code := doAPI(t, s, "GET", "/api/users/kam/posts", reader, "", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a revoked token but got %d", code)
+	}
+}
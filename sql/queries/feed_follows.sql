@@ -1,12 +1,13 @@
 -- name: CreateFeedFollow :one
 WITH inserted AS (
-  INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id) 
+  INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, category) 
   VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6
   ) 
   RETURNING *
 )
@@ -19,7 +20,16 @@ JOIN feeds ON inserted.feed_id = feeds.id;
 SELECT 
     feed_follows.*, 
     feeds.name AS feed_name, 
-    users.name AS user_name
+    feeds.url AS feed_url,
+    users.name AS user_name,
+    (
+        SELECT COUNT(*) FROM posts
+        WHERE posts.feed_id = feed_follows.feed_id
+          AND NOT EXISTS (
+            SELECT 1 FROM post_reads
+            WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+          )
+    ) AS unread_count
 FROM feed_follows
 JOIN feeds ON feed_follows.feed_id = feeds.id
 JOIN users ON feed_follows.user_id = users.id
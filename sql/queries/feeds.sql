@@ -11,7 +11,9 @@ VALUES (
 RETURNING *;
 
 -- name: GetFeeds :many
-SELECT feeds.name, feeds.url, users.name FROM feeds
+SELECT feeds.id, feeds.name, feeds.url, users.name, feeds.last_fetched_at, feeds.last_status,
+    feeds.last_error, feeds.consecutive_failures, feeds.next_fetch_at, feeds.disabled_at
+FROM feeds
 INNER JOIN users
 ON feeds.user_id = users.id;
 
@@ -20,11 +22,113 @@ SELECT * FROM feeds WHERE url = $1;
 
 -- name: MarkFeedFetched :one
 UPDATE feeds 
-SET last_fetched_at = NOW(), updated_at = NOW()
+SET last_fetched_at = NOW(), updated_at = NOW(), lease_owner = NULL, lease_expires_at = NULL,
+    last_status = $2, last_error = NULL, consecutive_failures = 0, next_fetch_at = NULL
 WHERE feeds.ID = $1
 RETURNING *;
 
--- name: GetNextFeedToFetch :one
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+-- name: MarkFeedFetchFailed :one
+UPDATE feeds
+SET last_fetched_at = NOW(), updated_at = NOW(), lease_owner = NULL, lease_expires_at = NULL,
+    last_error = sqlc.arg(last_error)::text,
+    last_status = sqlc.narg(last_status),
+    consecutive_failures = consecutive_failures + 1,
+    next_fetch_at = NOW() + make_interval(secs => sqlc.arg(backoff_seconds)::int),
+    disabled_at = CASE
+        WHEN consecutive_failures + 1 >= sqlc.arg(max_failures)::int THEN NOW()
+        ELSE NULL
+    END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET lease_owner = sqlc.arg(lease_owner)::text,
+    lease_expires_at = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::int),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (lease_expires_at IS NULL OR lease_expires_at < NOW())
+        AND disabled_at IS NULL
+        AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+        AND (last_fetched_at IS NULL OR last_fetched_at < sqlc.arg(due_before)::timestamptz)
+    ORDER BY last_fetched_at ASC NULLS FIRST
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ExtendFeedLease :execrows
+UPDATE feeds
+SET lease_expires_at = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::int)
+WHERE id = sqlc.arg(id) AND lease_owner = sqlc.arg(lease_owner)::text;
+
+-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner = NULL, lease_expires_at = NULL
+WHERE id = $1 AND lease_owner = sqlc.arg(lease_owner)::text;
+
+-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE id = $1;
+
+-- name: RenameFeed :one
+UPDATE feeds
+SET name = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: UpdateFeedURL :one
+UPDATE feeds
+SET url = $3, updated_at = NOW(), etag = NULL, last_modified = NULL,
+    last_status = NULL, last_error = NULL, consecutive_failures = 0,
+    next_fetch_at = NULL, disabled_at = NULL
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteFeed :execrows
+DELETE FROM feeds WHERE id = $1 AND user_id = $2;
+
+-- name: MoveFeed :exec
+UPDATE feeds SET url = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: MergeFeedInto :exec
+-- Moves the follows, posts, read marks and saved post links of one feed onto
+-- another and deletes it. Follows and posts the target already has (by user
+-- and by guid) are left behind and deleted with the old feed. The target takes
+-- over the old feed's lease unless another aggregator holds one on it.
+WITH moved_follows AS (
+    UPDATE feed_follows
+    SET feed_id = sqlc.arg(into_id), updated_at = NOW()
+    WHERE feed_id = sqlc.arg(from_id)
+        AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = sqlc.arg(into_id))
+), moved_posts AS (
+    UPDATE posts
+    SET feed_id = sqlc.arg(into_id), updated_at = NOW()
+    WHERE feed_id = sqlc.arg(from_id)
+        AND guid NOT IN (SELECT guid FROM posts WHERE feed_id = sqlc.arg(into_id))
+), copied_reads AS (
+    INSERT INTO post_reads (user_id, post_id, read_at)
+    SELECT post_reads.user_id, new_posts.id, post_reads.read_at
+    FROM post_reads
+    INNER JOIN posts AS old_posts ON old_posts.id = post_reads.post_id
+    INNER JOIN posts AS new_posts ON new_posts.guid = old_posts.guid
+    WHERE old_posts.feed_id = sqlc.arg(from_id) AND new_posts.feed_id = sqlc.arg(into_id)
+    ON CONFLICT DO NOTHING
+), relinked_saves AS (
+    UPDATE saved_posts
+    SET post_id = new_posts.id
+    FROM posts AS old_posts, posts AS new_posts
+    WHERE saved_posts.post_id = old_posts.id
+        AND old_posts.feed_id = sqlc.arg(from_id)
+        AND new_posts.feed_id = sqlc.arg(into_id)
+        AND new_posts.guid = old_posts.guid
+), moved_lease AS (
+    UPDATE feeds
+    SET lease_owner = old_feed.lease_owner, lease_expires_at = old_feed.lease_expires_at
+    FROM feeds AS old_feed
+    WHERE feeds.id = sqlc.arg(into_id) AND old_feed.id = sqlc.arg(from_id)
+        AND (feeds.lease_expires_at IS NULL OR feeds.lease_expires_at < NOW())
+)
+DELETE FROM feeds WHERE feeds.id = sqlc.arg(from_id);
@@ -1,5 +1,20 @@
--- name: CreatePost :one
-INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id)
+-- name: AdoptLegacyPostGUID :execrows
+-- Posts stored before posts had a guid were given their url as guid by
+-- 010_posts_guid.sql. Re-keys such a post to the guid of the item it came
+-- from, unless that guid is taken, so the upsert that follows updates it
+-- instead of inserting a duplicate.
+UPDATE posts
+SET guid = sqlc.arg(guid)
+WHERE feed_id = sqlc.arg(feed_id)
+    AND guid = sqlc.arg(url)
+    AND url = sqlc.arg(url)
+    AND NOT EXISTS (
+        SELECT 1 FROM posts taken
+        WHERE taken.feed_id = sqlc.arg(feed_id) AND taken.guid = sqlc.arg(guid)
+    );
+
+-- name: UpsertPost :one
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_synthesized, guid)
 VALUES (
     $1,
     $2,
@@ -8,17 +23,51 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10
 )
-RETURNING *;
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+    OR posts.url IS DISTINCT FROM EXCLUDED.url
+    OR posts.description IS DISTINCT FROM EXCLUDED.description
+RETURNING id, (xmax = 0)::boolean AS inserted;
 
 -- name: GetPostForUser :many
-SELECT 
-  posts.*, 
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description,
+  posts.published_at, posts.feed_id, posts.published_at_synthesized, posts.guid,
   feeds.name AS feed_name
 FROM posts
 JOIN feeds ON posts.feed_id = feeds.id
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND (NOT sqlc.arg(unread_only)::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_reads
+    WHERE post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg(user_id)
+  ))
+  AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+ORDER BY posts.published_at DESC, posts.id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SearchPostsForUser :many
+SELECT
+  posts.id, posts.title, posts.url, posts.published_at, posts.published_at_synthesized,
+  feeds.name AS feed_name,
+  ts_rank(posts.search_vector, query)::real AS rank,
+  ts_headline('english', coalesce(posts.description, posts.title), query,
+    'StartSel=**, StopSel=**, MaxFragments=2, MaxWords=25, MinWords=10')::text AS snippet
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id,
+  websearch_to_tsquery('english', sqlc.arg(query)::text) AS query
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND posts.search_vector @@ query
+  AND (sqlc.narg(feed_url)::text IS NULL OR feeds.url = sqlc.narg(feed_url)::text)
+  AND (sqlc.narg(since)::timestamptz IS NULL OR posts.published_at >= sqlc.narg(since)::timestamptz)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg(max_results);
@@ -0,0 +1,39 @@
+-- name: SavePost :one
+-- Saving a post again keeps its note unless a new one is given.
+INSERT INTO saved_posts (id, created_at, updated_at, user_id, post_id, title, url, description, feed_name, published_at, note)
+SELECT
+    sqlc.arg(id)::uuid,
+    sqlc.arg(created_at)::timestamp,
+    sqlc.arg(updated_at)::timestamp,
+    sqlc.arg(user_id)::uuid,
+    posts.id,
+    posts.title,
+    posts.url,
+    posts.description,
+    feeds.name,
+    posts.published_at,
+    sqlc.narg(note)::text
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = sqlc.arg(post_id)
+ON CONFLICT (user_id, url) DO UPDATE
+SET note = COALESCE(EXCLUDED.note, saved_posts.note), updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: DeleteSavedPost :execrows
+DELETE FROM saved_posts
+WHERE user_id = sqlc.arg(user_id)
+  AND (url = sqlc.arg(ref)::text OR post_id::text = sqlc.arg(ref)::text);
+
+-- name: GetSavedPostsForUser :many
+-- search is matched literally: \, % and _ in it must be escaped with a
+-- backslash.
+SELECT * FROM saved_posts
+WHERE user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(search)::text IS NULL
+    OR title ILIKE '%' || sqlc.narg(search)::text || '%' ESCAPE '\'
+    OR description ILIKE '%' || sqlc.narg(search)::text || '%' ESCAPE '\'
+    OR note ILIKE '%' || sqlc.narg(search)::text || '%' ESCAPE '\'
+  )
+ORDER BY created_at DESC;
@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN guid TEXT;
+
+-- Existing posts only have their link to go by. Where an item's real guid
+-- differs (Atom ids, RSS guids that aren't permalinks) the scraper re-keys
+-- the post with AdoptLegacyPostGUID on the next fetch rather than storing
+-- the item again.
+UPDATE posts SET guid = url;
+
+ALTER TABLE posts
+ALTER COLUMN guid SET NOT NULL,
+DROP CONSTRAINT posts_url_key,
+ADD CONSTRAINT posts_feed_guid_key UNIQUE (feed_id, guid);
+
+-- +goose Down
+-- The same link may now appear in several feeds; keep the oldest copy so
+-- the unique url constraint can be restored.
+DELETE FROM posts a
+USING posts b
+WHERE a.url = b.url AND (a.created_at, a.id) > (b.created_at, b.id);
+
+ALTER TABLE posts
+DROP CONSTRAINT posts_feed_guid_key,
+ADD CONSTRAINT posts_url_key UNIQUE (url),
+DROP COLUMN guid;
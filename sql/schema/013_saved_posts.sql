@@ -0,0 +1,20 @@
+-- +goose Up
+-- Saved posts keep their own copy of the post so they survive the post
+-- being removed along with its feed.
+CREATE TABLE saved_posts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID REFERENCES posts(id) ON DELETE SET NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT,
+    feed_name TEXT NOT NULL,
+    published_at TIMESTAMP NOT NULL,
+    note TEXT,
+    CONSTRAINT saved_posts_user_url_key UNIQUE (user_id, url)
+);
+
+-- +goose Down
+DROP TABLE saved_posts;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Only the SHA-256 of a token is stored; the token itself is shown once, when
+-- it is created. scopes is a comma-separated list such as "read,write".
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT NOT NULL,
+    last_used_at TIMESTAMP,
+    CONSTRAINT api_tokens_user_name_key UNIQUE (user_id, name)
+);
+
+-- +goose Down
+DROP TABLE api_tokens;
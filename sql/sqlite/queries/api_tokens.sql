@@ -0,0 +1,32 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (id, created_at, user_id, name, token_hash, scopes)
+VALUES (
+    sqlc.arg(id),
+    sqlc.arg(created_at),
+    sqlc.arg(user_id),
+    sqlc.arg(name),
+    sqlc.arg(token_hash),
+    sqlc.arg(scopes)
+)
+RETURNING *;
+
+-- name: GetAPITokensForUser :many
+SELECT * FROM api_tokens
+WHERE user_id = ?
+ORDER BY created_at;
+
+-- name: GetUserByAPIToken :one
+SELECT users.*, api_tokens.id AS token_id, api_tokens.scopes
+FROM api_tokens
+JOIN users ON api_tokens.user_id = users.id
+WHERE api_tokens.token_hash = ?;
+
+-- name: MarkAPITokenUsed :exec
+UPDATE api_tokens
+SET last_used_at = sqlc.arg(last_used_at)
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteAPIToken :execrows
+DELETE FROM api_tokens
+WHERE user_id = sqlc.arg(user_id)
+  AND (name = sqlc.arg(ref) OR id = sqlc.arg(ref));
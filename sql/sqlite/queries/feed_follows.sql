@@ -0,0 +1,36 @@
+-- name: CreateFeedFollow :one
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, category)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+RETURNING *,
+    (SELECT name FROM users WHERE users.id = feed_follows.user_id) AS user_name,
+    (SELECT name FROM feeds WHERE feeds.id = feed_follows.feed_id) AS feed_name;
+
+-- name: GetFeedFollowsForUser :many
+SELECT
+    feed_follows.*,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    users.name AS user_name,
+    (
+        SELECT COUNT(*) FROM posts
+        WHERE posts.feed_id = feed_follows.feed_id
+          AND NOT EXISTS (
+            SELECT 1 FROM post_reads
+            WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+          )
+    ) AS unread_count
+FROM feed_follows
+JOIN feeds ON feed_follows.feed_id = feeds.id
+JOIN users ON feed_follows.user_id = users.id
+WHERE feed_follows.user_id = ?;
+
+-- name: DeleteFollows :exec
+DELETE FROM feed_follows
+WHERE user_id = ? AND feed_id = ?;
@@ -0,0 +1,150 @@
+-- Timestamps are written in the format go-sqlite3 uses for time.Time
+-- parameters, which the Go side always passes in UTC, so that they compare
+-- correctly as text.
+
+-- name: CreateFeed :one
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+RETURNING *;
+
+-- name: GetFeeds :many
+SELECT feeds.id, feeds.name, feeds.url, users.name, feeds.last_fetched_at, feeds.last_status,
+    feeds.last_error, feeds.consecutive_failures, feeds.next_fetch_at, feeds.disabled_at
+FROM feeds
+INNER JOIN users
+ON feeds.user_id = users.id;
+
+-- name: GetFeedByURL :one
+SELECT * FROM feeds WHERE url = ?;
+
+-- name: MarkFeedFetched :one
+UPDATE feeds
+SET last_fetched_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    lease_owner = NULL, lease_expires_at = NULL,
+    last_status = sqlc.narg(last_status), last_error = NULL, consecutive_failures = 0, next_fetch_at = NULL
+WHERE feeds.id = sqlc.arg(id)
+RETURNING *;
+
+-- name: MarkFeedFetchFailed :one
+UPDATE feeds
+SET last_fetched_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    lease_owner = NULL, lease_expires_at = NULL,
+    last_error = sqlc.arg(last_error),
+    last_status = sqlc.narg(last_status),
+    consecutive_failures = consecutive_failures + 1,
+    next_fetch_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', sqlc.arg(backoff_seconds) || ' seconds'),
+    disabled_at = CASE
+        WHEN consecutive_failures + 1 >= sqlc.arg(max_failures) THEN strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+        ELSE NULL
+    END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: ClaimFeedsToFetch :many
+-- SQLite has a single writer, so the subquery cannot race with another
+-- aggregator the way FOR UPDATE SKIP LOCKED guards against in Postgres.
+UPDATE feeds
+SET lease_owner = sqlc.arg(lease_owner),
+    lease_expires_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', sqlc.arg(lease_seconds) || ' seconds'),
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (lease_expires_at IS NULL OR lease_expires_at < strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+        AND disabled_at IS NULL
+        AND (next_fetch_at IS NULL OR next_fetch_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+        AND (last_fetched_at IS NULL OR last_fetched_at < sqlc.arg(due_before))
+    ORDER BY last_fetched_at ASC NULLS FIRST
+    LIMIT sqlc.arg(batch_size)
+)
+RETURNING *;
+
+-- name: ExtendFeedLease :execrows
+UPDATE feeds
+SET lease_expires_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', sqlc.arg(lease_seconds) || ' seconds')
+WHERE id = sqlc.arg(id) AND lease_owner = sqlc.arg(lease_owner);
+
+-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner = NULL, lease_expires_at = NULL
+WHERE id = ? AND lease_owner = ?;
+
+-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = sqlc.narg(etag), last_modified = sqlc.narg(last_modified),
+    updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = sqlc.arg(id);
+
+-- name: RenameFeed :one
+UPDATE feeds
+SET name = sqlc.arg(name), updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: UpdateFeedURL :one
+UPDATE feeds
+SET url = sqlc.arg(url), updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'), etag = NULL, last_modified = NULL,
+    last_status = NULL, last_error = NULL, consecutive_failures = 0,
+    next_fetch_at = NULL, disabled_at = NULL
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: DeleteFeed :execrows
+DELETE FROM feeds WHERE id = ? AND user_id = ?;
+
+-- name: MoveFeed :exec
+UPDATE feeds SET url = ?, updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = ?;
+
+-- SQLite has no data-modifying CTEs, so merging one feed into another is
+-- split into the queries below, which the caller runs in one transaction
+-- in this order. Follows and posts the target already has (by user and by
+-- guid) are left behind and deleted with the old feed, and the target takes
+-- over the old feed's lease unless another aggregator holds one on it.
+
+-- name: MoveFollowsInto :exec
+UPDATE feed_follows
+SET feed_id = sqlc.arg(into_id), updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE feed_id = sqlc.arg(from_id)
+    AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = sqlc.arg(into_id));
+
+-- name: CopyReadsInto :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT post_reads.user_id, new_posts.id, post_reads.read_at
+FROM post_reads
+INNER JOIN posts AS old_posts ON old_posts.id = post_reads.post_id
+INNER JOIN posts AS new_posts ON new_posts.guid = old_posts.guid
+WHERE old_posts.feed_id = sqlc.arg(from_id) AND new_posts.feed_id = sqlc.arg(into_id)
+ON CONFLICT DO NOTHING;
+
+-- name: RelinkSavedPostsInto :exec
+UPDATE saved_posts
+SET post_id = new_posts.id
+FROM posts AS old_posts, posts AS new_posts
+WHERE saved_posts.post_id = old_posts.id
+    AND old_posts.feed_id = sqlc.arg(from_id)
+    AND new_posts.feed_id = sqlc.arg(into_id)
+    AND new_posts.guid = old_posts.guid;
+
+-- name: MovePostsInto :exec
+UPDATE posts
+SET feed_id = sqlc.arg(into_id), updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+WHERE feed_id = sqlc.arg(from_id)
+    AND guid NOT IN (SELECT guid FROM posts WHERE feed_id = sqlc.arg(into_id));
+
+-- name: MoveLeaseInto :exec
+UPDATE feeds
+SET lease_owner = old_feed.lease_owner, lease_expires_at = old_feed.lease_expires_at
+FROM feeds AS old_feed
+WHERE feeds.id = sqlc.arg(into_id) AND old_feed.id = sqlc.arg(from_id)
+    AND (feeds.lease_expires_at IS NULL OR feeds.lease_expires_at < strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+
+-- name: DeleteFeedByID :exec
+DELETE FROM feeds WHERE id = ?;
@@ -0,0 +1,29 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES (?, ?, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :exec
+DELETE FROM post_reads
+WHERE user_id = ? AND post_id = ?;
+
+-- name: MarkFeedRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT sqlc.arg(user_id), posts.id, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+FROM posts
+WHERE posts.feed_id = sqlc.arg(feed_id)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkFeedUnread :execrows
+DELETE FROM post_reads
+WHERE post_reads.user_id = sqlc.arg(user_id)
+  AND post_reads.post_id IN (SELECT posts.id FROM posts WHERE posts.feed_id = sqlc.arg(feed_id));
+
+-- name: MarkPostsReadBefore :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND posts.published_at < sqlc.arg(before)
+ON CONFLICT (user_id, post_id) DO NOTHING;
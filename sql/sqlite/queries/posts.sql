@@ -0,0 +1,75 @@
+-- name: AdoptLegacyPostGUID :execrows
+-- Only Postgres databases have posts from before posts had a guid, which
+-- 010_posts_guid.sql gave their url as guid. This is the same query so both
+-- stores behave alike.
+UPDATE posts
+SET guid = sqlc.arg(guid)
+WHERE feed_id = sqlc.arg(feed_id)
+    AND guid = sqlc.arg(url)
+    AND url = sqlc.arg(url)
+    AND NOT EXISTS (
+        SELECT 1 FROM posts taken
+        WHERE taken.feed_id = sqlc.arg(feed_id) AND taken.guid = sqlc.arg(guid)
+    );
+
+-- name: UpsertPost :one
+-- A post that already existed keeps its id, so comparing the returned id
+-- with the new one tells inserts from updates, like xmax does in Postgres.
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_synthesized, guid)
+VALUES (
+    sqlc.arg(id),
+    sqlc.arg(created_at),
+    sqlc.arg(updated_at),
+    sqlc.arg(title),
+    sqlc.arg(url),
+    sqlc.arg(description),
+    sqlc.arg(published_at),
+    sqlc.arg(feed_id),
+    sqlc.arg(published_at_synthesized),
+    sqlc.arg(guid)
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = excluded.title,
+    url = excluded.url,
+    description = excluded.description,
+    updated_at = excluded.updated_at
+WHERE posts.title IS NOT excluded.title
+    OR posts.url IS NOT excluded.url
+    OR posts.description IS NOT excluded.description
+RETURNING id, CAST(id = sqlc.arg(id) AS BOOLEAN) AS inserted;
+
+-- name: GetPostForUser :many
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description,
+  posts.published_at, posts.feed_id, posts.published_at_synthesized, posts.guid,
+  feeds.name AS feed_name
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND (NOT sqlc.arg(unread_only) OR NOT EXISTS (
+    SELECT 1 FROM post_reads
+    WHERE post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg(user_id)
+  ))
+  AND (sqlc.narg(feed_id) IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+ORDER BY posts.published_at DESC, posts.id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SearchPostsForUser :many
+-- query is an FTS4 MATCH expression. FTS4 has no ranking function, so rank
+-- is the number of matched terms, which offsets() lists four numbers for.
+SELECT
+  posts.id, posts.title, posts.url, posts.published_at, posts.published_at_synthesized,
+  feeds.name AS feed_name,
+  CAST((length(offsets(posts_fts)) - length(replace(offsets(posts_fts), ' ', '')) + 1) / 4 AS REAL) AS rank,
+  snippet(posts_fts, '**', '**', '...', -1, 25) AS snippet
+FROM posts_fts
+JOIN posts ON posts.rowid = posts_fts.docid
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE posts_fts MATCH sqlc.arg(query)
+  AND feed_follows.user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(feed_url) IS NULL OR feeds.url = sqlc.narg(feed_url))
+  AND (sqlc.narg(since) IS NULL OR posts.published_at >= sqlc.narg(since))
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg(max_results);
@@ -0,0 +1,40 @@
+-- name: SavePost :one
+-- Saving a post again keeps its note unless a new one is given.
+INSERT INTO saved_posts (id, created_at, updated_at, user_id, post_id, title, url, description, feed_name, published_at, note)
+SELECT
+    sqlc.arg(id),
+    sqlc.arg(created_at),
+    sqlc.arg(updated_at),
+    sqlc.arg(user_id),
+    posts.id,
+    posts.title,
+    posts.url,
+    posts.description,
+    feeds.name,
+    posts.published_at,
+    sqlc.narg(note)
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = sqlc.arg(post_id)
+ON CONFLICT (user_id, url) DO UPDATE
+SET note = COALESCE(excluded.note, saved_posts.note), updated_at = excluded.updated_at
+RETURNING *;
+
+-- name: DeleteSavedPost :execrows
+DELETE FROM saved_posts
+WHERE user_id = sqlc.arg(user_id)
+  AND (url = sqlc.arg(ref) OR post_id = sqlc.arg(ref));
+
+-- name: GetSavedPostsForUser :many
+-- search is matched literally: \, % and _ in it must be escaped with a
+-- backslash. LIKE is case-insensitive for ASCII in SQLite, standing in for
+-- ILIKE.
+SELECT * FROM saved_posts
+WHERE user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(search) IS NULL
+    OR title LIKE '%' || sqlc.narg(search) || '%' ESCAPE '\'
+    OR description LIKE '%' || sqlc.narg(search) || '%' ESCAPE '\'
+    OR note LIKE '%' || sqlc.narg(search) || '%' ESCAPE '\'
+  )
+ORDER BY created_at DESC;
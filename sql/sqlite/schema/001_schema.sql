@@ -0,0 +1,115 @@
+-- +goose Up
+-- The SQLite schema starts out at the state sql/schema reached in
+-- 014_feed_follow_categories.sql. Later changes to the Postgres schema need
+-- a matching migration here.
+--
+-- UUIDs are stored as text and timestamps as the text go-sqlite3 writes for
+-- a time.Time, always in UTC, so they sort correctly as strings.
+CREATE TABLE users (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE feeds (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    name TEXT UNIQUE NOT NULL,
+    url TEXT UNIQUE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_fetched_at TIMESTAMP,
+    etag TEXT,
+    last_modified TEXT,
+    lease_owner TEXT,
+    lease_expires_at TIMESTAMP,
+    last_error TEXT,
+    last_status INTEGER,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    next_fetch_at TIMESTAMP,
+    disabled_at TIMESTAMP
+);
+
+CREATE TABLE feed_follows (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    feed_id UUID NOT NULL,
+    category TEXT,
+    CONSTRAINT unique_ids UNIQUE (user_id, feed_id),
+    CONSTRAINT foreign_key_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT foreign_key_feed FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE
+);
+
+CREATE TABLE posts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT,
+    published_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    published_at_synthesized BOOLEAN NOT NULL DEFAULT FALSE,
+    guid TEXT NOT NULL,
+    CONSTRAINT posts_feed_guid_key UNIQUE (feed_id, guid)
+);
+
+-- Full-text index over posts, kept in sync by the triggers below. It is
+-- keyed on the rowid of posts, which only changes if the database is
+-- vacuumed by hand; run INSERT INTO posts_fts(posts_fts) VALUES ('rebuild')
+-- after doing that.
+CREATE VIRTUAL TABLE posts_fts USING fts4(
+    content="posts", title, description, tokenize=porter
+);
+
+CREATE TRIGGER posts_fts_before_update BEFORE UPDATE ON posts BEGIN
+    DELETE FROM posts_fts WHERE docid = old.rowid;
+END;
+
+CREATE TRIGGER posts_fts_before_delete BEFORE DELETE ON posts BEGIN
+    DELETE FROM posts_fts WHERE docid = old.rowid;
+END;
+
+CREATE TRIGGER posts_fts_after_update AFTER UPDATE ON posts BEGIN
+    INSERT INTO posts_fts (docid, title, description) VALUES (new.rowid, new.title, new.description);
+END;
+
+CREATE TRIGGER posts_fts_after_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts (docid, title, description) VALUES (new.rowid, new.title, new.description);
+END;
+
+CREATE TABLE post_reads (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    read_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- Saved posts keep their own copy of the post so they survive the post
+-- being removed along with its feed.
+CREATE TABLE saved_posts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID REFERENCES posts(id) ON DELETE SET NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT,
+    feed_name TEXT NOT NULL,
+    published_at TIMESTAMP NOT NULL,
+    note TEXT,
+    CONSTRAINT saved_posts_user_url_key UNIQUE (user_id, url)
+);
+
+-- +goose Down
+DROP TABLE saved_posts;
+DROP TABLE post_reads;
+DROP TABLE posts_fts;
+DROP TABLE posts;
+DROP TABLE feed_follows;
+DROP TABLE feeds;
+DROP TABLE users;
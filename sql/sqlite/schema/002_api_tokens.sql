@@ -0,0 +1,15 @@
+-- +goose Up
+-- Matches sql/schema/015_api_tokens.sql.
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT NOT NULL,
+    last_used_at TIMESTAMP,
+    CONSTRAINT api_tokens_user_name_key UNIQUE (user_id, name)
+);
+
+-- +goose Down
+DROP TABLE api_tokens;
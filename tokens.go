@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// tokenEnv names the environment variable that makes the commands act as
+// the owner of an API token instead of the user logged in with login.
+const tokenEnv = "GATOR_TOKEN"
+
+// Scopes limit what an API token may do. They are independent: a token that
+// should both read posts and mark them read needs read and write.
+const (
+	// scopeRead allows reading feeds, follows, posts and saved posts.
+	scopeRead = "read"
+	// scopeWrite allows changing the user's own state: follows, read marks
+	// and saved posts.
+	scopeWrite = "write"
+	// scopeManageFeeds allows adding feeds and changing or deleting the
+	// feeds the user added.
+	scopeManageFeeds = "manage-feeds"
+)
+
+var allScopes = []string{scopeRead, scopeWrite, scopeManageFeeds}
+
+var errInvalidToken = errors.New("invalid or revoked API token")
+
+// parseScopes checks a comma-separated list of scopes and returns it in the
+// order of allScopes, without duplicates, the way it is stored.
+func parseScopes(value string) (string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(allScopes, scope) {
+			return "", fmt.Errorf("unknown scope %q, use %s", scope, strings.Join(allScopes, ", "))
+		}
+		scopes = append(scopes, scope)
+	}
+	var canonical []string
+	for _, scope := range allScopes {
+		if slices.Contains(scopes, scope) {
+			canonical = append(canonical, scope)
+		}
+	}
+	return strings.Join(canonical, ","), nil
+}
+
+func hasScope(scopes, scope string) bool {
+	return slices.Contains(strings.Split(scopes, ","), scope)
+}
+
+// newAPIToken returns a random token and the hash to store for it.
+func newAPIToken() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := "gator_" + base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashAPIToken(token), nil
+}
+
+// hashAPIToken returns the hex SHA-256 of token. Tokens are random enough
+// that a fast unsalted hash is as good as a password hash here.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateToken returns the owner of token and the token's scopes, or
+// errInvalidToken if there is no such token.
+func authenticateToken(ctx context.Context, s *state, token string) (database.User, string, error) {
+	row, err := s.db.GetUserByAPIToken(ctx, hashAPIToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, "", errInvalidToken
+	}
+	if err != nil {
+		return database.User{}, "", fmt.Errorf("failed to look up API token: %w", err)
+	}
+	err = s.db.MarkAPITokenUsed(ctx, database.MarkAPITokenUsedParams{
+		LastUsedAt: time.Now(),
+		ID:         row.TokenID,
+	})
+	if err != nil {
+		return database.User{}, "", fmt.Errorf("failed to record API token use: %w", err)
+	}
+	user := database.User{
+		ID:        row.ID,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+		Name:      row.Name,
+	}
+	return user, row.Scopes, nil
+}
+
+// handlerToken manages the API tokens of the user logged in with login.
+// Tokens can't manage tokens, so it refuses to run with GATOR_TOKEN set.
+func handlerToken(ctx context.Context, s *state, cmd command) error {
+	usage := fmt.Errorf("usage: token create <name> [--scope %s] | token list | token revoke <name or id>",
+		strings.Join(allScopes, ","))
+	if len(cmd.args) == 0 {
+		return usage
+	}
+	if os.Getenv(tokenEnv) != "" {
+		return fmt.Errorf("token manages the tokens of the user logged in with login, unset %s to use it", tokenEnv)
+	}
+	user, err := s.db.GetUser(ctx, s.cfg.CurrentUserName)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	subcommand := cmd.args[0]
+	fs := flag.NewFlagSet("token "+subcommand, flag.ContinueOnError)
+	scope := fs.String("scope", scopeRead, "comma-separated scopes to grant: "+strings.Join(allScopes, ", "))
+	args, err := parseFlags(fs, cmd.args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case subcommand == "create" && len(args) == 1:
+		return createToken(ctx, s, user, args[0], *scope)
+	case subcommand == "list" && len(args) == 0:
+		return listTokens(ctx, s, user)
+	case subcommand == "revoke" && len(args) == 1:
+		deleted, err := s.db.DeleteAPIToken(ctx, database.DeleteAPITokenParams{
+			UserID: user.ID,
+			Ref:    args[0],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+		if deleted == 0 {
+			return fmt.Errorf("no token %s, see token list", args[0])
+		}
+		fmt.Printf("Revoked token %s\n", args[0])
+	default:
+		return usage
+	}
+	return nil
+}
+
+func createToken(ctx context.Context, s *state, user database.User, name, scope string) error {
+	scopes, err := parseScopes(scope)
+	if err != nil {
+		return err
+	}
+	tokens, err := s.db.GetAPITokensForUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get tokens: %w", err)
+	}
+	for _, token := range tokens {
+		if token.Name == name {
+			return fmt.Errorf("a token named %s already exists, revoke it first", name)
+		}
+	}
+
+	token, hash, err := newAPIToken()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.CreateAPIToken(ctx, database.CreateAPITokenParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hash,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	fmt.Printf("Created token %s for %s with scopes %s. It is only shown this once:\n%s\n", name, user.Name, scopes, token)
+	return nil
+}
+
+func listTokens(ctx context.Context, s *state, user database.User) error {
+	tokens, err := s.db.GetAPITokensForUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get tokens: %w", err)
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens, create one with token create <name>")
+		return nil
+	}
+	for _, token := range tokens {
+		lastUsed := "never"
+		if token.LastUsedAt.Valid {
+			lastUsed = token.LastUsedAt.Time.Format(time.RFC822)
+		}
+		fmt.Printf("%s (%s)\nScopes: %s\nCreated: %s\nLast used: %s\n\n",
+			token.Name, token.ID, token.Scopes, token.CreatedAt.Format(time.RFC822), lastUsed)
+	}
+	return nil
+}
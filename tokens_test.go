@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/blog_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// createTestToken creates a token named "test" for user and returns it.
+func createTestToken(t *testing.T, s *state, user database.User, scopes ...string) string {
+	t.Helper()
+	token, hash, err := newAPIToken()
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	_, err = s.db.CreateAPIToken(context.Background(), database.CreateAPITokenParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		Name:      "test",
+		TokenHash: hash,
+		Scopes:    strings.Join(scopes, ","),
+	})
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	return token
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"read", "read", false},
+		{"manage-feeds, read,read", "read,manage-feeds", false},
+		{"read,admin", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseScopes(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseScopes(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	user := createTestUser(t, s, "kam")
+	if err := s.cfgManager.SetUser(s.cfg, user.Name); err != nil {
+		t.Fatalf("failed to set user: %v", err)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return handlerToken(ctx, s, command{name: "token", args: []string{"create", "dashboard", "--scope", "read,write"}})
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	token := lines[len(lines)-1]
+	if !strings.HasPrefix(token, "gator_") {
+		t.Fatalf("Expected the token to be printed but got: %q", out)
+	}
+	authenticated, scopes, err := authenticateToken(ctx, s, token)
+	if err != nil || authenticated.ID != user.ID || scopes != "read,write" {
+		t.Errorf("Expected the token to authenticate kam with read,write but got %+v, %q, %v", authenticated, scopes, err)
+	}
+
+	err = handlerToken(ctx, s, command{name: "token", args: []string{"create", "dashboard"}})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected an error for a duplicate name but got: %v", err)
+	}
+
+	out, err = captureStdout(t, func() error {
+		return handlerToken(ctx, s, command{name: "token", args: []string{"list"}})
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if !strings.Contains(out, "dashboard") || strings.Contains(out, token) || strings.Contains(out, "Last used: never") {
+		t.Errorf("Expected the used token to be listed without its secret but got: %q", out)
+	}
+
+	t.Setenv(tokenEnv, token)
+	if err := handlerToken(ctx, s, command{name: "token", args: []string{"list"}}); err == nil {
+		t.Errorf("Expected token to refuse to run with %s set", tokenEnv)
+	}
+	t.Setenv(tokenEnv, "")
+
+	if _, err := captureStdout(t, func() error {
+		return handlerToken(ctx, s, command{name: "token", args: []string{"revoke", "dashboard"}})
+	}); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if _, _, err := authenticateToken(ctx, s, token); !errors.Is(err, errInvalidToken) {
+		t.Errorf("Expected a revoked token to be rejected but got: %v", err)
+	}
+	if err := handlerToken(ctx, s, command{name: "token", args: []string{"revoke", "dashboard"}}); err == nil {
+		t.Errorf("Expected an error revoking an unknown token")
+	}
+}
+
+func TestMiddlewareLoggedInToken(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestState(t)
+	kam := createTestUser(t, s, "kam")
+	bob := createTestUser(t, s, "bob")
+	if err := s.cfgManager.SetUser(s.cfg, kam.Name); err != nil {
+		t.Fatalf("failed to set user: %v", err)
+	}
+	token := createTestToken(t, s, bob, scopeRead)
+
+	var got database.User
+	handler := func(ctx context.Context, s *state, cmd command, user database.User) error {
+		got = user
+		return nil
+	}
+
+	if err := middlewareLoggedIn(scopeRead, handler)(ctx, s, command{name: "browse"}); err != nil || got.ID != kam.ID {
+		t.Errorf("Expected the logged in user without a token but got %s, %v", got.Name, err)
+	}
+	t.Setenv(tokenEnv, token)
+	if err := middlewareLoggedIn(scopeRead, handler)(ctx, s, command{name: "browse"}); err != nil || got.ID != bob.ID {
+		t.Errorf("Expected the token's owner but got %s, %v", got.Name, err)
+	}
+	if err := middlewareLoggedIn(scopeWrite, handler)(ctx, s, command{name: "follow"}); err == nil || !strings.Contains(err.Error(), "lacks the write scope") {
+		t.Errorf("Expected a missing scope error but got: %v", err)
+	}
+	t.Setenv(tokenEnv, "gator_unknown")
+	if err := middlewareLoggedIn(scopeRead, handler)(ctx, s, command{name: "browse"}); err == nil {
+		t.Errorf("Expected an unknown token to be rejected")
+	}
+}